@@ -0,0 +1,421 @@
+package gxtb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type AccountChangeKind int
+
+const (
+	ACCOUNT_SNAPSHOT AccountChangeKind = iota
+	ACCOUNT_BALANCE
+	ACCOUNT_POSITION_OPENED
+	ACCOUNT_POSITION_MODIFIED
+	ACCOUNT_POSITION_CLOSED
+	ACCOUNT_ORDER_PLACED
+	ACCOUNT_ORDER_MODIFIED
+	ACCOUNT_ORDER_DELETED
+	ACCOUNT_PROFIT
+)
+
+// AccountChange describes a single change of the account state, Position is
+// zero for snapshot and balance changes.
+type AccountChange struct {
+	Kind     AccountChangeKind
+	Position int
+}
+
+type AccountChangeCb func(AccountChange)
+
+// Account mirrors the account state. It is initialized from a snapshot and kept
+// current by the balance, trades and profits streams, which the caller
+// subscribes to HandleBalance, HandleTrade and HandleProfit before the first
+// Sync so nothing happening during the snapshot is missed. All readers return
+// copies.
+type Account struct {
+	api     Broker
+	errorCb func(error)
+	clock   Clock
+
+	mu       sync.RWMutex
+	user     UserData
+	balance  Balance
+	trades   map[int]TradeRecord // Open positions and pending orders by position number
+	synced   time.Time
+	changeCb []AccountChangeCb
+	syncing  int            // Syncs waiting for their snapshot
+	missed   []accountEvent // Stream messages received while syncing
+}
+
+// accountEvent is a stream message, exactly one field is set.
+type accountEvent struct {
+	trade   *Trade
+	balance *Balance
+	profit  *Profit
+}
+
+func NewAccount(api Broker) *Account {
+
+	return &Account{
+		api:    api,
+		clock:  SystemClock,
+		trades: make(map[int]TradeRecord),
+	}
+}
+
+// SetClock stamps LastSync with the time of a Simulator or Replayer.
+func (a *Account) SetClock(clock Clock) {
+	a.clock = clock
+}
+
+// SetErrorCallback receives the errors of the periodic syncs of Reconcile.
+func (a *Account) SetErrorCallback(cb func(error)) {
+	a.errorCb = cb
+}
+
+// OnChange registers a callback invoked after every change of the state.
+func (a *Account) OnChange(cb AccountChangeCb) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.changeCb = append(a.changeCb, cb)
+}
+
+// Sync replaces the state with a fresh snapshot from the api. Stream messages
+// received while the snapshot is requested are applied again on top of it, so
+// changes the snapshot does not contain yet are kept.
+func (a *Account) Sync(ctx context.Context) error {
+
+	a.mu.Lock()
+	a.syncing++
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		a.syncing--
+		if a.syncing == 0 {
+			a.missed = nil
+		}
+		a.mu.Unlock()
+	}()
+
+	user, err := a.api.GetCurrentUserData(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to sync account: %w", err)
+	}
+
+	margin, err := a.api.GetMarginLevel(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to sync account: %w", err)
+	}
+
+	records, err := a.api.GetTrades(ctx, true)
+	if err != nil {
+		return fmt.Errorf("unable to sync account: %w", err)
+	}
+
+	trades := make(map[int]TradeRecord, len(records))
+	for _, rec := range records {
+		trades[rec.Position] = rec
+	}
+
+	a.mu.Lock()
+	a.user = user
+	a.balance = Balance{
+		Balance:     margin.Balance,
+		Credit:      margin.Credit,
+		Equity:      margin.Equity,
+		Margin:      margin.Margin,
+		MarginFree:  margin.MarginFree,
+		MarginLevel: margin.MarginLevel,
+	}
+	a.trades = trades
+	a.synced = a.clock.Now()
+	for _, event := range a.missed {
+		switch {
+		case event.trade != nil:
+			a.applyTrade(*event.trade)
+		case event.balance != nil:
+			a.balance = *event.balance
+		case event.profit != nil:
+			a.applyProfit(*event.profit)
+		}
+	}
+	a.mu.Unlock()
+
+	a.notify(AccountChange{Kind: ACCOUNT_SNAPSHOT})
+
+	return nil
+}
+
+// Reconcile syncs the state in the given interval until the context is
+// canceled. A failed sync leaves the state to the streams until the next one.
+func (a *Account) Reconcile(ctx context.Context, interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("unable to reconcile account: interval %v is not positive", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := a.Sync(ctx); err != nil && a.errorCb != nil {
+				a.errorCb(err)
+			}
+		}
+	}
+}
+
+// HandleBalance is the GetBalanceCb of the account.
+func (a *Account) HandleBalance(balance Balance) {
+
+	a.mu.Lock()
+	a.balance = balance
+	a.record(accountEvent{balance: &balance})
+	a.mu.Unlock()
+
+	a.notify(AccountChange{Kind: ACCOUNT_BALANCE})
+}
+
+// HandleProfit is the GetProfitsCb of the account.
+func (a *Account) HandleProfit(profit Profit) {
+
+	a.mu.Lock()
+	exists := a.applyProfit(profit)
+	a.record(accountEvent{profit: &profit})
+	a.mu.Unlock()
+
+	if exists {
+		a.notify(AccountChange{Kind: ACCOUNT_PROFIT, Position: profit.Position})
+	}
+}
+
+// applyProfit must be called with the lock held.
+func (a *Account) applyProfit(profit Profit) bool {
+
+	rec, exists := a.trades[profit.Position]
+	if exists {
+		rec.Profit = profit.Profit
+		a.trades[profit.Position] = rec
+	}
+
+	return exists
+}
+
+// HandleTrade is the GetTradesCb of the account. Closing a part of a
+// position reduces its volume and is reported as a modification.
+func (a *Account) HandleTrade(trade Trade) {
+
+	a.mu.Lock()
+	change, changed := a.applyTrade(trade)
+	a.record(accountEvent{trade: &trade})
+	a.mu.Unlock()
+
+	if changed {
+		a.notify(change)
+	}
+}
+
+// applyTrade must be called with the lock held.
+func (a *Account) applyTrade(trade Trade) (AccountChange, bool) {
+
+	pending := trade.TradeType == int(TYPE_PENDING)
+	closed := trade.Closed || trade.TradeType == int(TYPE_CLOSE)
+	removed := closed || trade.State == TRADE_STATE_DELETED
+
+	prev, existed := a.trades[trade.Position]
+	if removed && closed && existed && trade.Volume < prev.Volume-volumeEpsilon {
+		prev.Volume = roundDigits(prev.Volume-trade.Volume, 8)
+		a.trades[trade.Position] = prev
+		removed = false
+	} else if removed {
+		delete(a.trades, trade.Position)
+	} else {
+		rec := TradeToRecord(trade)
+		if trade.Profit == nil {
+			rec.Profit = prev.Profit
+		}
+		a.trades[trade.Position] = rec
+	}
+
+	var kind AccountChangeKind
+	switch {
+	case removed && !existed:
+		return AccountChange{}, false
+	case removed && pending:
+		kind = ACCOUNT_ORDER_DELETED
+	case removed:
+		kind = ACCOUNT_POSITION_CLOSED
+	case pending && existed:
+		kind = ACCOUNT_ORDER_MODIFIED
+	case pending:
+		kind = ACCOUNT_ORDER_PLACED
+	case existed:
+		kind = ACCOUNT_POSITION_MODIFIED
+	default:
+		kind = ACCOUNT_POSITION_OPENED
+	}
+
+	return AccountChange{Kind: kind, Position: trade.Position}, true
+}
+
+// record keeps the message for the running syncs. It must be called with the
+// lock held.
+func (a *Account) record(event accountEvent) {
+
+	if a.syncing > 0 {
+		a.missed = append(a.missed, event)
+	}
+}
+
+func (a *Account) UserData() UserData {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.user
+}
+
+func (a *Account) Currency() string {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.user.Currency
+}
+
+func (a *Account) Balance() Balance {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.balance
+}
+
+// LastSync returns the time of the last snapshot.
+func (a *Account) LastSync() time.Time {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.synced
+}
+
+// Positions returns the open positions ordered by open time.
+func (a *Account) Positions() []TradeRecord {
+
+	return a.filter(func(rec TradeRecord) bool {
+		return isMarketCmd(TradeCmd(rec.Cmd))
+	})
+}
+
+// PendingOrders returns the pending orders ordered by open time.
+func (a *Account) PendingOrders() []TradeRecord {
+
+	return a.filter(func(rec TradeRecord) bool {
+		return !isMarketCmd(TradeCmd(rec.Cmd))
+	})
+}
+
+// Position returns the open position or pending order with the given position number.
+func (a *Account) Position(position int) (TradeRecord, bool) {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, exists := a.trades[position]
+	return rec, exists
+}
+
+// Profit returns the sum of profits of all open positions.
+func (a *Account) Profit() float64 {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var profit float64
+	for _, rec := range a.trades {
+		if isMarketCmd(TradeCmd(rec.Cmd)) {
+			profit += rec.Profit
+		}
+	}
+
+	return profit
+}
+
+func (a *Account) filter(match func(TradeRecord) bool) []TradeRecord {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var records []TradeRecord
+	for _, rec := range a.trades {
+		if match(rec) {
+			records = append(records, rec)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].OpenTime == records[j].OpenTime {
+			return records[i].Position < records[j].Position
+		}
+		return records[i].OpenTime < records[j].OpenTime
+	})
+
+	return records
+}
+
+func (a *Account) notify(change AccountChange) {
+
+	a.mu.RLock()
+	cbs := append([]AccountChangeCb(nil), a.changeCb...)
+	a.mu.RUnlock()
+
+	for _, cb := range cbs {
+		cb(change)
+	}
+}
+
+// TradeToRecord converts a trades stream message into a TradeRecord.
+func TradeToRecord(trade Trade) TradeRecord {
+
+	rec := TradeRecord{
+		ClosePrice:    trade.ClosePrice,
+		CloseTime:     trade.CloseTime,
+		Closed:        trade.Closed,
+		Cmd:           trade.Cmd,
+		Comment:       trade.Comment,
+		Commission:    trade.Commission,
+		CustomComment: trade.CustomComment,
+		Digits:        trade.Digits,
+		Expiration:    trade.Expiration,
+		MarginRate:    trade.MarginRate,
+		Offset:        trade.Offset,
+		OpenPrice:     trade.OpenPrice,
+		OpenTime:      trade.OpenTime,
+		Order:         trade.Order,
+		Order2:        trade.Order2,
+		Position:      trade.Position,
+		SL:            trade.StopLoss,
+		Storage:       trade.Storage,
+		Symbol:        trade.Symbol,
+		TP:            trade.TakeProfit,
+		Volume:        trade.Volume,
+	}
+
+	if trade.Profit != nil {
+		rec.Profit = *trade.Profit
+	}
+
+	return rec
+}
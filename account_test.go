@@ -0,0 +1,101 @@
+package gxtb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// staleBroker answers GetTrades with the trades from before calling during,
+// like a snapshot taken just before a stream message arrives.
+type staleBroker struct {
+	*Simulator
+	during func()
+}
+
+func (b *staleBroker) GetTrades(ctx context.Context, openedOnly bool) ([]TradeRecord, error) {
+
+	trades, err := b.Simulator.GetTrades(ctx, openedOnly)
+	if b.during != nil {
+		b.during()
+	}
+
+	return trades, err
+}
+
+func TestAccountSyncKeepsStreamedChanges(t *testing.T) {
+
+	ctx := context.Background()
+
+	sim := NewSimulator([]SymbolInfo{{
+		Symbol:         "EURUSD",
+		Currency:       "EUR",
+		CurrencyProfit: "USD",
+		ContractSize:   100000,
+		Leverage:       5,
+		LotMin:         0.01,
+		LotStep:        0.01,
+		MarginMode:     MARGIN_MODE_FOREX,
+		Precision:      5,
+	}}, SimulatorOptions{Currency: "USD", Balance: 10000})
+	sim.HandleTick(TickPrice{Symbol: "EURUSD", Bid: 1.1, Ask: 1.1002, Timestamp: time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC).UnixMilli()})
+
+	broker := &staleBroker{Simulator: sim}
+	account := NewAccount(broker)
+
+	stream := sim.Stream()
+	stream.GetTrades(ctx, account.HandleTrade)
+	stream.GetBalance(ctx, account.HandleBalance)
+
+	for _, order := range []*OrderBuilder{MarketBuy("EURUSD", 1), MarketSell("EURUSD", 0.5)} {
+		if _, err := PlaceOrder(ctx, sim, order); err != nil {
+			t.Fatalf("PlaceOrder: %v", err)
+		}
+	}
+	if err := account.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	positions := account.Positions()
+	if len(positions) != 2 {
+		t.Fatalf("got %d positions, want 2", len(positions))
+	}
+
+	// The buy is closed and a new order is placed while the snapshot is on its way
+	closed := positions[0]
+	broker.during = func() {
+		if _, err := PlaceOrder(ctx, sim, ClosePosition("EURUSD", CMD_BUY, closed.Order, closed.Volume)); err != nil {
+			t.Errorf("close: %v", err)
+		}
+		if _, err := PlaceOrder(ctx, sim, LimitBuy("EURUSD", 1, 1.09)); err != nil {
+			t.Errorf("place: %v", err)
+		}
+	}
+	if err := account.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if _, open := account.Position(closed.Position); open {
+		t.Errorf("position %d closed during the sync is open", closed.Position)
+	}
+	if n := len(account.Positions()); n != 1 {
+		t.Errorf("got %d positions, want 1", n)
+	}
+	if n := len(account.PendingOrders()); n != 1 {
+		t.Errorf("got %d pending orders, want 1", n)
+	}
+
+	margin, _ := sim.GetMarginLevel(ctx)
+	if balance := account.Balance(); balance.Balance != margin.Balance {
+		t.Errorf("balance = %v, want %v after the close", balance.Balance, margin.Balance)
+	}
+
+	// Messages of a finished sync are not applied to the next snapshot
+	broker.during = nil
+	if err := account.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if n := len(account.PendingOrders()); n != 1 {
+		t.Errorf("got %d pending orders, want 1", n)
+	}
+}
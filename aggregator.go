@@ -0,0 +1,324 @@
+package gxtb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type PriceSource int
+
+const (
+	PRICE_BID PriceSource = iota
+	PRICE_ASK
+	PRICE_MID
+)
+
+// BarSpec defines when a bar completes. Exactly one of the fields is expected
+// to be set: a time interval (e.g. 5s, 3m, 2h), a number of ticks or a volume.
+type BarSpec struct {
+	Interval  time.Duration
+	TickCount int
+	Volume    float64
+}
+
+type AggregatorOptions struct {
+	Source      PriceSource
+	Location    *time.Location // Time bars are aligned to midnight in this location, UTC when nil
+	FillGaps    bool           // Emit flat bars for intervals without any input
+	MaxFillBars int            // Longer gaps, e.g. closed markets, are not filled, the default when not positive
+	SendTimeout time.Duration  // Time a completed bar waits for room in a full channel before it is dropped
+}
+
+func DefaultAggregatorOptions() AggregatorOptions {
+	return AggregatorOptions{
+		Source:      PRICE_BID,
+		Location:    brokerLocation(),
+		MaxFillBars: 60,
+		SendTimeout: time.Second,
+	}
+}
+
+// BarUpdate is emitted for every change of the bar being built and once more
+// with Complete set when it closes. Bars with an interval of whole minutes
+// carry the matching Period, others have a zero Period.
+type BarUpdate struct {
+	Bar      Bar
+	Complete bool
+}
+
+type BarUpdateCb func(BarUpdate)
+
+// Aggregator builds bars of arbitrary timeframe from ticks or M1 candles of
+// one symbol.
+type Aggregator struct {
+	symbol string
+	spec   BarSpec
+	opts   AggregatorOptions
+
+	mu      sync.Mutex
+	current *Bar
+	ticks   int
+	end     time.Time
+	cbs     []BarUpdateCb
+	chans   []chan BarUpdate
+}
+
+func NewAggregator(symbol string, spec BarSpec, opts AggregatorOptions) *Aggregator {
+
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.MaxFillBars <= 0 {
+		opts.MaxFillBars = DefaultAggregatorOptions().MaxFillBars
+	}
+
+	return &Aggregator{
+		symbol: symbol,
+		spec:   spec,
+		opts:   opts,
+	}
+}
+
+// OnBar registers a callback for bar updates.
+func (a *Aggregator) OnBar(cb BarUpdateCb) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.cbs = append(a.cbs, cb)
+}
+
+// Channel returns a channel of bar updates. In-progress updates are dropped
+// when the channel is full, completed bars wait up to SendTimeout for room.
+func (a *Aggregator) Channel(size int) <-chan BarUpdate {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ch := make(chan BarUpdate, size)
+	a.chans = append(a.chans, ch)
+	return ch
+}
+
+// Current returns the bar being built.
+func (a *Aggregator) Current() (Bar, bool) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.current == nil {
+		return Bar{}, false
+	}
+
+	return *a.current, true
+}
+
+// HandleTick is a GetTickPricesCb feeding the aggregator, only top of the book
+// ticks of the aggregated symbol are used.
+func (a *Aggregator) HandleTick(tick TickPrice) {
+
+	if tick.Level != 0 || tick.Symbol != a.symbol {
+		return
+	}
+
+	var price, volume float64
+	switch a.opts.Source {
+	case PRICE_ASK:
+		price, volume = tick.Ask, float64(tick.AskVolume)
+	case PRICE_MID:
+		price, volume = (tick.Bid+tick.Ask)/2, float64(tick.BidVolume+tick.AskVolume)/2
+	default:
+		price, volume = tick.Bid, float64(tick.BidVolume)
+	}
+
+	a.update(time.UnixMilli(tick.Timestamp).UTC(), price, price, price, price, volume, 1)
+}
+
+// HandleCandle is a GetCandlesCb feeding the aggregator with M1 candles.
+func (a *Aggregator) HandleCandle(candle Candle) {
+
+	if candle.Symbol != a.symbol {
+		return
+	}
+
+	a.update(time.UnixMilli(candle.Ctm).UTC(), candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, 1)
+}
+
+// HandleBar feeds a bar of a finer timeframe of the aggregated symbol, e.g.
+// from history.
+func (a *Aggregator) HandleBar(bar Bar) {
+
+	if bar.Symbol != a.symbol {
+		return
+	}
+
+	a.update(bar.Time, bar.Open, bar.High, bar.Low, bar.Close, bar.Volume, 1)
+}
+
+// Backfill feeds the M1 bars since the given time, so the first bars are
+// complete right after startup. Only time bars of at least a minute benefit.
+func (a *Aggregator) Backfill(ctx context.Context, api MarketData, since time.Time) error {
+
+	data, err := api.GetChartLastRequest(ctx, ChartLastInfo{
+		Period: PERIOD_M1,
+		Start:  int(since.UnixMilli()),
+		Symbol: a.symbol,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to backfill %s: %w", a.symbol, err)
+	}
+
+	for _, bar := range BarsFromChartData(a.symbol, PERIOD_M1, data) {
+		a.HandleBar(bar)
+	}
+
+	return nil
+}
+
+// Advance completes the time bar being built when now is past its end, so
+// bars close on the clock even without further input.
+func (a *Aggregator) Advance(now time.Time) {
+
+	a.mu.Lock()
+	var updates []BarUpdate
+	if a.spec.Interval > 0 && a.current != nil && !now.Before(a.end) {
+		updates = append(updates, BarUpdate{*a.current, true})
+		a.current = nil
+	}
+	a.mu.Unlock()
+
+	a.emit(updates)
+}
+
+func (a *Aggregator) update(ts time.Time, open, high, low, close, volume float64, ticks int) {
+
+	a.mu.Lock()
+
+	var updates []BarUpdate
+
+	if a.current != nil && a.spec.Interval > 0 && !ts.Before(a.end) {
+		updates = append(updates, BarUpdate{*a.current, true})
+		prev := *a.current
+		a.current = nil
+
+		next := a.align(ts)
+		if a.opts.FillGaps && next.Sub(a.end) <= a.spec.Interval*time.Duration(a.opts.MaxFillBars) {
+			for start := a.end; start.Before(next); start = start.Add(a.spec.Interval) {
+				flat := a.newBar(start, prev.Close, prev.Close, prev.Close, prev.Close, 0)
+				updates = append(updates, BarUpdate{flat, true})
+			}
+		}
+	}
+
+	if a.current == nil {
+		start := ts
+		if a.spec.Interval > 0 {
+			start = a.align(ts)
+			a.end = start.Add(a.spec.Interval)
+		}
+		bar := a.newBar(start, open, high, low, close, volume)
+		a.current = &bar
+		a.ticks = ticks
+	} else {
+		a.current.High = math.Max(a.current.High, high)
+		a.current.Low = math.Min(a.current.Low, low)
+		a.current.Close = close
+		a.current.Volume += volume
+		a.ticks += ticks
+	}
+
+	complete := (a.spec.TickCount > 0 && a.ticks >= a.spec.TickCount) ||
+		(a.spec.Volume > 0 && a.current.Volume >= a.spec.Volume)
+
+	updates = append(updates, BarUpdate{*a.current, complete})
+	if complete {
+		a.current = nil
+	}
+
+	a.mu.Unlock()
+
+	a.emit(updates)
+}
+
+func (a *Aggregator) newBar(start time.Time, open, high, low, close, volume float64) Bar {
+
+	var period Period
+	if a.spec.Interval > 0 && a.spec.Interval%time.Minute == 0 {
+		period = Period(a.spec.Interval / time.Minute)
+	}
+
+	return Bar{
+		Symbol: a.symbol,
+		Period: period,
+		Time:   start,
+		Open:   open,
+		High:   high,
+		Low:    low,
+		Close:  close,
+		Volume: volume,
+	}
+}
+
+// align truncates the time to the interval, counted from midnight in the
+// configured location.
+func (a *Aggregator) align(ts time.Time) time.Time {
+
+	local := ts.In(a.opts.Location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, a.opts.Location)
+
+	if a.spec.Interval >= 24*time.Hour {
+		_, offset := local.Zone()
+		shift := time.Duration(offset) * time.Second
+		return ts.Add(shift).Truncate(a.spec.Interval).Add(-shift).UTC()
+	}
+
+	return midnight.Add(ts.Sub(midnight).Truncate(a.spec.Interval)).UTC()
+}
+
+func (a *Aggregator) emit(updates []BarUpdate) {
+
+	if len(updates) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	cbs := append([]BarUpdateCb(nil), a.cbs...)
+	chans := append([]chan BarUpdate(nil), a.chans...)
+	a.mu.Unlock()
+
+	for _, update := range updates {
+		for _, cb := range cbs {
+			cb(update)
+		}
+		for _, ch := range chans {
+			select {
+			case ch <- update:
+				continue
+			default:
+			}
+			if update.Complete && a.opts.SendTimeout > 0 {
+				timer := time.NewTimer(a.opts.SendTimeout)
+				select {
+				case ch <- update:
+				case <-timer.C:
+				}
+				timer.Stop()
+			}
+		}
+	}
+}
+
+// brokerLocation returns the broker time, XTB publishes trading hours and
+// aligns candles in central european time.
+func brokerLocation() *time.Location {
+
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		return time.FixedZone("CET", 3600)
+	}
+
+	return loc
+}
@@ -3,11 +3,21 @@ package gxtb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// ErrRealTradingDisabled is returned for trade transactions on a real account
+// which the client was not allowed to trade on, nothing was sent.
+var ErrRealTradingDisabled = errors.New("trading on real account is not allowed, set ApiOptions.AllowRealTrading")
+
+// ErrNoResponse is returned when a command was not answered, the server may
+// or may not have processed it.
+var ErrNoResponse = errors.New("no response received")
+
 type apiCommand struct {
 	Command   string      `json:"command"`
 	Arguments interface{} `json:"arguments,omitempty"`
@@ -18,12 +28,30 @@ type extendedArguments struct {
 	TradeTransInfo interface{} `json:"tradeTransInfo,omitempty"`
 }
 
+// taggedCommand carries the customTag echoed by the server, which pairs
+// responses with their commands.
+type taggedCommand struct {
+	apiCommand
+	CustomTag string `json:"customTag"`
+}
+
 type apiResponse struct {
 	Status          bool            `json:"status"`
 	ReturnData      json.RawMessage `json:"returnData,omitempty"`
 	StreamSessionId string          `json:"streamSessionId,omitempty"`
 	ErrorCode       string          `json:"errorCode,omitempty"`
 	ErrorDescr      string          `json:"errorDescr,omitempty"`
+	CustomTag       string          `json:"customTag,omitempty"`
+}
+
+// ApiError is returned when the server processed a command and refused it.
+type ApiError struct {
+	Code        string
+	Description string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("%s - %s", e.Code, e.Description)
 }
 
 type ApiClient struct {
@@ -32,16 +60,26 @@ type ApiClient struct {
 	opts          ApiOptions
 	sessionId     string
 	mu            sync.Mutex
+	tag           int
 	keepAliveCncl context.CancelFunc
+
+	dryRunMu     sync.Mutex
+	dryRunOrder  int
+	dryRunOrders map[int]TransactionInfo
 }
 
 func NewApiClient(opts ApiOptions) *ApiClient {
 
 	return &ApiClient{
-		opts: opts,
+		opts:         opts,
+		dryRunOrders: make(map[int]TransactionInfo),
 	}
 }
 
+func (c *ApiClient) IsDemo() bool {
+	return c.opts.IsDemo()
+}
+
 func (c *ApiClient) Connect(ctx context.Context) error {
 
 	if err := c.connect(ctx, c.opts.GetUrl()); err != nil {
@@ -402,6 +440,26 @@ func (c *ApiClient) GetTradesHistory(ctx context.Context, end, start int) ([]Tra
 	return tradeRecords, nil
 }
 
+func (c *ApiClient) GetTradingHours(ctx context.Context, symbols []string) ([]TradingHours, error) {
+
+	args := struct {
+		Symbols []string `json:"symbols"`
+	}{symbols}
+
+	var tradingHours []TradingHours
+
+	resp, err := c.sendRecieve(ctx, apiCommand{"getTradingHours", args})
+	if err != nil {
+		return tradingHours, fmt.Errorf("unable to process getTradingHours api call: %w", err)
+	}
+
+	if err := json.Unmarshal(resp.ReturnData, &tradingHours); err != nil {
+		return tradingHours, fmt.Errorf("unable to unmarshal getTradingHours response: %w", err)
+	}
+
+	return tradingHours, nil
+}
+
 func (c *ApiClient) GetVersion(ctx context.Context) (string, error) {
 
 	versionData := struct {
@@ -424,6 +482,18 @@ func (c *ApiClient) TradeTransaction(ctx context.Context, txnInfo TransactionInf
 
 	var orderId OrderId
 
+	if !c.IsDemo() && !c.opts.AllowRealTrading {
+		return orderId, fmt.Errorf("unable to process tradeTransaction api call: %w", ErrRealTradingDisabled)
+	}
+
+	if c.opts.DryRun {
+		orderId = c.dryRunTransaction(txnInfo)
+		if c.opts.DryRunCb != nil {
+			c.opts.DryRunCb(txnInfo, orderId)
+		}
+		return orderId, nil
+	}
+
 	resp, err := c.sendRecieve(ctx, apiCommand{"tradeTransaction", extendedArguments{TradeTransInfo: txnInfo}})
 	if err != nil {
 		return orderId, fmt.Errorf("unable to process tradeTransaction api call: %w", err)
@@ -444,6 +514,10 @@ func (c *ApiClient) TradeTransactionStatus(ctx context.Context, orderId int) (Tr
 
 	var txnStatus TransactionStatus
 
+	if c.opts.DryRun {
+		return c.dryRunStatus(orderId), nil
+	}
+
 	resp, err := c.sendRecieve(ctx, apiCommand{"tradeTransactionStatus", args})
 	if err != nil {
 		return txnStatus, fmt.Errorf("unable to process tradeTransactionStatus api call: %w", err)
@@ -456,6 +530,37 @@ func (c *ApiClient) TradeTransactionStatus(ctx context.Context, orderId int) (Tr
 	return txnStatus, nil
 }
 
+func (c *ApiClient) dryRunTransaction(txnInfo TransactionInfo) OrderId {
+
+	c.dryRunMu.Lock()
+	defer c.dryRunMu.Unlock()
+
+	c.dryRunOrder++
+	c.dryRunOrders[c.dryRunOrder] = txnInfo
+
+	return OrderId{c.dryRunOrder}
+}
+
+func (c *ApiClient) dryRunStatus(orderId int) TransactionStatus {
+
+	c.dryRunMu.Lock()
+	defer c.dryRunMu.Unlock()
+
+	txnInfo, exists := c.dryRunOrders[orderId]
+	if !exists {
+		msg := "unknown dry run order"
+		return TransactionStatus{Order: orderId, Message: &msg, RequestStatus: REQUEST_STATUS_ERROR}
+	}
+
+	return TransactionStatus{
+		Ask:           float32(txnInfo.Price),
+		Bid:           float32(txnInfo.Price),
+		CustomComment: txnInfo.CustomComment,
+		Order:         orderId,
+		RequestStatus: REQUEST_STATUS_ACCEPTED,
+	}
+}
+
 func (c *ApiClient) sendRecieve(ctx context.Context, cmd apiCommand) (apiResponse, error) {
 
 	c.mu.Lock()
@@ -463,7 +568,10 @@ func (c *ApiClient) sendRecieve(ctx context.Context, cmd apiCommand) (apiRespons
 
 	var resp apiResponse
 
-	req, err := json.Marshal(cmd)
+	c.tag++
+	tag := strconv.Itoa(c.tag)
+
+	req, err := json.Marshal(taggedCommand{cmd, tag})
 	if err != nil {
 		return resp, fmt.Errorf("failed to marshal %v: %w", cmd, err)
 	}
@@ -472,20 +580,28 @@ func (c *ApiClient) sendRecieve(ctx context.Context, cmd apiCommand) (apiRespons
 	defer ctxCancel()
 
 	if err := c.write(ctx, req); err != nil {
-		return resp, fmt.Errorf("failed to send %v: %w", req, err)
+		return resp, fmt.Errorf("%w: failed to send %s: %w", ErrNoResponse, req, err)
 	}
 
-	respData, err := c.read(ctx)
-	if err != nil {
-		return resp, fmt.Errorf("failed to read: %w", err)
-	}
+	for {
+		respData, err := c.read(ctx)
+		if err != nil {
+			return resp, fmt.Errorf("%w: failed to read: %w", ErrNoResponse, err)
+		}
 
-	if err := json.Unmarshal(respData, &resp); err != nil {
-		return resp, fmt.Errorf("failed to unmarshal %s: %w", respData, err)
+		resp = apiResponse{}
+		if err := json.Unmarshal(respData, &resp); err != nil {
+			return resp, fmt.Errorf("failed to unmarshal %s: %w", respData, err)
+		}
+
+		// Late responses of commands which timed out are skipped
+		if resp.CustomTag == "" || resp.CustomTag == tag {
+			break
+		}
 	}
 
 	if !resp.Status {
-		return resp, fmt.Errorf("%s - %s", resp.ErrorCode, resp.ErrorDescr)
+		return resp, &ApiError{resp.ErrorCode, resp.ErrorDescr}
 	}
 
 	return resp, nil
@@ -0,0 +1,84 @@
+package gxtb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestSendRecieveSkipsLateResponses runs commands against a server which
+// answers the first one only after it timed out, together with a response of
+// a command the client never sent.
+func TestSendRecieveSkipsLateResponses(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer ws.Close()
+
+		reply := func(tag string) {
+			data := json.RawMessage(`"` + tag + `"`)
+			ws.WriteJSON(apiResponse{Status: true, ReturnData: data, CustomTag: tag})
+		}
+
+		var late string
+		for {
+			var cmd taggedCommand
+			if err := ws.ReadJSON(&cmd); err != nil {
+				return
+			}
+
+			switch cmd.Command {
+			case "slow":
+				late = cmd.CustomTag
+			default:
+				if late != "" {
+					reply(late)
+					late = ""
+				}
+				reply("unknown")
+				reply(cmd.CustomTag)
+			}
+		}
+	}))
+	defer server.Close()
+
+	opts := DefaultDemoApiOptions()
+	opts.ApiCallTimeout = time.Millisecond * 100
+
+	c := NewApiClient(opts)
+	if err := c.connect(context.Background(), url.URL{Scheme: "ws", Host: server.Listener.Addr().String()}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.disconnect()
+
+	if _, err := c.sendRecieve(context.Background(), apiCommand{Command: "slow"}); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("slow command: %v, want ErrNoResponse", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.sendRecieve(context.Background(), apiCommand{Command: "ping"})
+		if err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+
+		// The slow command was tagged 1
+		var tag string
+		json.Unmarshal(resp.ReturnData, &tag)
+		if want := strconv.Itoa(i + 2); tag != want {
+			t.Errorf("ping tagged %s got the response of %q", want, tag)
+		}
+	}
+}
@@ -10,51 +10,51 @@ const (
 )
 
 type SymbolInfo struct {
-	Ask                float64  `json:"ask"`
-	Bid                float64  `json:"bid"`
-	CategoryName       string   `json:"categoryName"`
-	ContractSize       int      `json:"contractSize"`
-	Currency           string   `json:"currency"`
-	CurrencyPair       bool     `json:"currencyPair"`
-	CurrencyProfit     string   `json:"currencyProfit"`
-	Description        string   `json:"description"`
-	Expiration         *string  `json:"expiration"` // Nullable field
-	GroupName          string   `json:"groupName"`
-	High               float64  `json:"high"`
-	InitialMargin      float64  `json:"initialMargin"`
-	InstantMaxVolume   float64  `json:"instantMaxVolume"`
-	Leverage           float64  `json:"leverage"`
-	LongOnly           bool     `json:"longOnly"`
-	LotMax             float64  `json:"lotMax"`
-	LotMin             float64  `json:"lotMin"`
-	LotStep            float64  `json:"lotStep"`
-	Low                float64  `json:"low"`
-	MarginHedged       float64  `json:"marginHedged"`
-	MarginHedgedStrong bool     `json:"marginHedgedStrong"`
-	MarginMaintenance  *float64 `json:"marginMaintenance"` // Nullable field
-	MarginMode         int      `json:"marginMode"`
-	Percentage         float64  `json:"percentage"`
-	Precision          int      `json:"precision"`
-	ProfitMode         int      `json:"profitMode"`
-	QuoteId            int      `json:"quoteId"`
-	ShortSelling       bool     `json:"shortSelling"`
-	SpreadRaw          float64  `json:"spreadRaw"`
-	SpreadTable        float64  `json:"spreadTable"`
-	Starting           *string  `json:"starting"` // Nullable field
-	StepRuleId         int      `json:"stepRuleId"`
-	StopsLevel         float64  `json:"stopsLevel"`
-	SwapRollover3Days  float64  `json:"swap_rollover3days"`
-	SwapEnable         bool     `json:"swapEnable"`
-	SwapLong           float64  `json:"swapLong"`
-	SwapShort          float64  `json:"swapShort"`
-	SwapType           int      `json:"swapType"`
-	Symbol             string   `json:"symbol"`
-	TickSize           float64  `json:"tickSize"`
-	TickValue          float64  `json:"tickValue"`
-	Time               int64    `json:"time"`
-	TimeString         string   `json:"timeString"`
-	TrailingEnabled    bool     `json:"trailingEnabled"`
-	Type               int      `json:"type"`
+	Ask                float64    `json:"ask"`
+	Bid                float64    `json:"bid"`
+	CategoryName       string     `json:"categoryName"`
+	ContractSize       int        `json:"contractSize"`
+	Currency           string     `json:"currency"`
+	CurrencyPair       bool       `json:"currencyPair"`
+	CurrencyProfit     string     `json:"currencyProfit"`
+	Description        string     `json:"description"`
+	Expiration         *string    `json:"expiration"` // Nullable field
+	GroupName          string     `json:"groupName"`
+	High               float64    `json:"high"`
+	InitialMargin      float64    `json:"initialMargin"`
+	InstantMaxVolume   float64    `json:"instantMaxVolume"`
+	Leverage           float64    `json:"leverage"`
+	LongOnly           bool       `json:"longOnly"`
+	LotMax             float64    `json:"lotMax"`
+	LotMin             float64    `json:"lotMin"`
+	LotStep            float64    `json:"lotStep"`
+	Low                float64    `json:"low"`
+	MarginHedged       float64    `json:"marginHedged"`
+	MarginHedgedStrong bool       `json:"marginHedgedStrong"`
+	MarginMaintenance  *float64   `json:"marginMaintenance"` // Nullable field
+	MarginMode         MarginMode `json:"marginMode"`
+	Percentage         float64    `json:"percentage"`
+	Precision          int        `json:"precision"`
+	ProfitMode         ProfitMode `json:"profitMode"`
+	QuoteId            int        `json:"quoteId"`
+	ShortSelling       bool       `json:"shortSelling"`
+	SpreadRaw          float64    `json:"spreadRaw"`
+	SpreadTable        float64    `json:"spreadTable"`
+	Starting           *string    `json:"starting"` // Nullable field
+	StepRuleId         int        `json:"stepRuleId"`
+	StopsLevel         float64    `json:"stopsLevel"`
+	SwapRollover3Days  float64    `json:"swap_rollover3days"`
+	SwapEnable         bool       `json:"swapEnable"`
+	SwapLong           float64    `json:"swapLong"`
+	SwapShort          float64    `json:"swapShort"`
+	SwapType           SwapType   `json:"swapType"`
+	Symbol             string     `json:"symbol"`
+	TickSize           float64    `json:"tickSize"`
+	TickValue          float64    `json:"tickValue"`
+	Time               int64      `json:"time"`
+	TimeString         string     `json:"timeString"`
+	TrailingEnabled    bool       `json:"trailingEnabled"`
+	Type               SymbolType `json:"type"`
 }
 
 type Calendar struct {
@@ -137,6 +137,18 @@ type TickRecord struct {
 	Timestamp   int64   `json:"timestamp"`
 }
 
+type HoursRecord struct {
+	Day   int   `json:"day"`
+	FromT int64 `json:"fromT"`
+	ToT   int64 `json:"toT"`
+}
+
+type TradingHours struct {
+	Quotes  []HoursRecord `json:"quotes"`
+	Symbol  string        `json:"symbol"`
+	Trading []HoursRecord `json:"trading"`
+}
+
 type TradeRecord struct {
 	ClosePrice       float64 `json:"close_price"`
 	CloseTime        *int64  `json:"close_time"`
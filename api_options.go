@@ -17,12 +17,19 @@ type ApiOptions struct {
 	ApiCallTimeout    time.Duration
 	KeepAliveInterval time.Duration
 	PollingInterval   time.Duration
+	AllowRealTrading  bool                           // Trade transactions on RealApi are refused unless set
+	DryRun            bool                           // Trade transactions are simulated instead of sent
+	DryRunCb          func(TransactionInfo, OrderId) // Receives the simulated trade transactions and their order numbers
 }
 
 func (o ApiOptions) GetUrl() url.URL {
 	return url.URL{Scheme: "wss", Host: "ws.xtb.com", Path: string(o.EndpointPath)}
 }
 
+func (o ApiOptions) IsDemo() bool {
+	return o.EndpointPath == DemoApi
+}
+
 func DefaultApiOptions() ApiOptions {
 	return ApiOptions{
 		EndpointPath:      RealApi,
@@ -0,0 +1,108 @@
+package gxtb
+
+import (
+	"math"
+	"time"
+)
+
+// Bar is an OHLC candle with absolute prices.
+type Bar struct {
+	Symbol string
+	Period Period
+	Time   time.Time // Open time of the bar, in UTC
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+	Digits int // Number of decimal places of the prices
+}
+
+// BarsFromChartData decodes the rate infos of a chart request. On the wire the
+// open is scaled by 10^Digits and high, low and close are scaled offsets from
+// the open. The conversion is lossless, RateInfo restores the original values.
+func BarsFromChartData(symbol string, period Period, data ChartData) []Bar {
+
+	bars := make([]Bar, 0, len(data.RateInfos))
+
+	for _, r := range data.RateInfos {
+		bars = append(bars, BarFromRateInfo(symbol, period, data.Digits, r))
+	}
+
+	return bars
+}
+
+func BarFromRateInfo(symbol string, period Period, digits int, r RateInfo) Bar {
+
+	scale := math.Pow10(digits)
+
+	return Bar{
+		Symbol: symbol,
+		Period: period,
+		Time:   time.UnixMilli(r.Ctm).UTC(),
+		Open:   roundDigits(r.Open/scale, digits),
+		High:   roundDigits((r.Open+r.High)/scale, digits),
+		Low:    roundDigits((r.Open+r.Low)/scale, digits),
+		Close:  roundDigits((r.Open+r.Close)/scale, digits),
+		Volume: r.Vol,
+		Digits: digits,
+	}
+}
+
+// BarFromCandle normalizes a getCandles stream candle, which carries absolute
+// prices, into a M1 bar. The digits are the precision of the symbol.
+func BarFromCandle(candle Candle, digits int) Bar {
+
+	return Bar{
+		Symbol: candle.Symbol,
+		Period: PERIOD_M1,
+		Time:   time.UnixMilli(candle.Ctm).UTC(),
+		Open:   roundDigits(candle.Open, digits),
+		High:   roundDigits(candle.High, digits),
+		Low:    roundDigits(candle.Low, digits),
+		Close:  roundDigits(candle.Close, digits),
+		Volume: candle.Volume,
+		Digits: digits,
+	}
+}
+
+// RateInfo encodes the bar back into the scaled wire format.
+func (b Bar) RateInfo() RateInfo {
+
+	scale := math.Pow10(b.Digits)
+	open := math.Round(b.Open * scale)
+
+	return RateInfo{
+		Close:     math.Round(b.Close*scale) - open,
+		Ctm:       b.Time.UnixMilli(),
+		CtmString: b.Time.Format("Jan 2, 2006, 3:04:05 PM"),
+		High:      math.Round(b.High*scale) - open,
+		Low:       math.Round(b.Low*scale) - open,
+		Open:      open,
+		Vol:       b.Volume,
+	}
+}
+
+// End returns the time the bar closes.
+func (b Bar) End() time.Time {
+	return b.Time.Add(b.Period.Duration())
+}
+
+// ChartDataFromBars encodes bars of one symbol into the chart request format.
+func ChartDataFromBars(bars []Bar) ChartData {
+
+	data := ChartData{RateInfos: make([]RateInfo, 0, len(bars))}
+
+	for _, bar := range bars {
+		data.Digits = bar.Digits
+		data.RateInfos = append(data.RateInfos, bar.RateInfo())
+	}
+
+	return data
+}
+
+func roundDigits(value float64, digits int) float64 {
+
+	scale := math.Pow10(digits)
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,274 @@
+package gxtb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeRange is the half open interval [From, To).
+type TimeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// BarStore persists bars per symbol and period together with the time
+// ranges they cover, so gaps can be told apart from periods without trading.
+type BarStore interface {
+	// Load returns the stored bars opened in [from, to) sorted by time.
+	Load(symbol string, period Period, from, to time.Time) ([]Bar, error)
+	// Save stores the bars, replacing stored bars at the same times, and marks covered as covered.
+	Save(symbol string, period Period, bars []Bar, covered TimeRange) error
+	// Coverage returns the covered ranges sorted and merged.
+	Coverage(symbol string, period Period) ([]TimeRange, error)
+}
+
+type barSeries struct {
+	Coverage []TimeRange `json:"coverage"`
+	Bars     []Bar       `json:"bars"`
+}
+
+// FileBarStore is a BarStore keeping one JSON file per symbol and period.
+type FileBarStore struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+func NewFileBarStore(dir string) (*FileBarStore, error) {
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create bar store %s: %w", dir, err)
+	}
+
+	return &FileBarStore{dir: dir}, nil
+}
+
+func (s *FileBarStore) Load(symbol string, period Period, from, to time.Time) ([]Bar, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, err := s.read(symbol, period)
+	if err != nil {
+		return nil, err
+	}
+
+	var bars []Bar
+	for _, bar := range series.Bars {
+		if !bar.Time.Before(from) && bar.Time.Before(to) {
+			bars = append(bars, bar)
+		}
+	}
+
+	return bars, nil
+}
+
+func (s *FileBarStore) Save(symbol string, period Period, bars []Bar, covered TimeRange) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, err := s.read(symbol, period)
+	if err != nil {
+		return err
+	}
+
+	byTime := make(map[int64]Bar, len(series.Bars)+len(bars))
+	for _, bar := range series.Bars {
+		byTime[bar.Time.UnixMilli()] = bar
+	}
+	for _, bar := range bars {
+		byTime[bar.Time.UnixMilli()] = bar
+	}
+
+	series.Bars = series.Bars[:0]
+	for _, bar := range byTime {
+		series.Bars = append(series.Bars, bar)
+	}
+	sort.Slice(series.Bars, func(i, j int) bool {
+		return series.Bars[i].Time.Before(series.Bars[j].Time)
+	})
+
+	series.Coverage = mergeRanges(append(series.Coverage, covered))
+
+	data, err := json.Marshal(series)
+	if err != nil {
+		return fmt.Errorf("unable to marshal %s bars: %w", symbol, err)
+	}
+
+	return writeFileAtomic(s.path(symbol, period), data)
+}
+
+func (s *FileBarStore) Coverage(symbol string, period Period) ([]TimeRange, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, err := s.read(symbol, period)
+	if err != nil {
+		return nil, err
+	}
+
+	return series.Coverage, nil
+}
+
+func (s *FileBarStore) read(symbol string, period Period) (barSeries, error) {
+
+	var series barSeries
+
+	data, err := os.ReadFile(s.path(symbol, period))
+	if errors.Is(err, os.ErrNotExist) {
+		return series, nil
+	}
+	if err != nil {
+		return series, fmt.Errorf("unable to read %s bars: %w", symbol, err)
+	}
+
+	if err := json.Unmarshal(data, &series); err != nil {
+		return series, fmt.Errorf("unable to unmarshal %s bars: %w", symbol, err)
+	}
+
+	return series, nil
+}
+
+func (s *FileBarStore) path(symbol string, period Period) string {
+
+	return filepath.Join(s.dir, fmt.Sprintf("%s_%d.json", symbolFileName(symbol), period))
+}
+
+// symbolFileName makes the symbol usable as a file or directory name which
+// stays within its parent directory.
+func symbolFileName(symbol string) string {
+
+	name := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(symbol)
+	if name == "" || name == "." || name == ".." {
+		name = strings.Repeat("_", len(name)+1)
+	}
+
+	return name
+}
+
+// CachedHistory serves bars from a BarStore and downloads only the ranges not
+// covered yet. Without a downloader it works offline on the stored bars.
+type CachedHistory struct {
+	downloader *HistoryDownloader
+	store      BarStore
+}
+
+func NewCachedHistory(downloader *HistoryDownloader, store BarStore) *CachedHistory {
+
+	return &CachedHistory{
+		downloader: downloader,
+		store:      store,
+	}
+}
+
+// Bars returns the bars opened in [from, to), downloading the missing gaps.
+func (c *CachedHistory) Bars(ctx context.Context, symbol string, period Period, from, to time.Time) ([]Bar, error) {
+
+	if c.downloader != nil {
+		if err := c.fill(ctx, symbol, period, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.store.Load(symbol, period, from, to)
+}
+
+func (c *CachedHistory) fill(ctx context.Context, symbol string, period Period, from, to time.Time) error {
+
+	coverage, err := c.store.Coverage(symbol, period)
+	if err != nil {
+		return err
+	}
+
+	closed := c.downloader.clock.Now().Add(-period.Duration())
+
+	for _, gap := range missingRanges(coverage, TimeRange{from, to}) {
+		bars, err := c.downloader.Bars(ctx, symbol, period, gap.From, gap.To)
+		if err != nil {
+			return err
+		}
+
+		// History older than the broker keeps was not downloaded and stays uncovered
+		covered := gap
+		if available := c.downloader.AvailableFrom(period); covered.From.Before(available) {
+			covered.From = available
+		}
+		if covered.To.After(closed) {
+			covered.To = closed
+		}
+		if !covered.From.Before(covered.To) {
+			covered = TimeRange{}
+		}
+
+		// A bar still forming is stored, but its range stays uncovered so it is
+		// downloaded and replaced again next time
+		if err := c.store.Save(symbol, period, bars, covered); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeRanges sorts the ranges and merges overlapping and adjacent ones,
+// empty ranges are dropped.
+func mergeRanges(ranges []TimeRange) []TimeRange {
+
+	var merged []TimeRange
+
+	sorted := append([]TimeRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].From.Before(sorted[j].From)
+	})
+
+	for _, r := range sorted {
+		if !r.From.Before(r.To) {
+			continue
+		}
+		if n := len(merged); n > 0 && !r.From.After(merged[n-1].To) {
+			if r.To.After(merged[n-1].To) {
+				merged[n-1].To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// missingRanges returns the parts of want not covered by the merged coverage.
+func missingRanges(coverage []TimeRange, want TimeRange) []TimeRange {
+
+	var missing []TimeRange
+	cursor := want.From
+
+	for _, r := range coverage {
+		if !r.To.After(cursor) {
+			continue
+		}
+		if !r.From.Before(want.To) {
+			break
+		}
+		if r.From.After(cursor) {
+			missing = append(missing, TimeRange{cursor, r.From})
+		}
+		cursor = r.To
+	}
+
+	if cursor.Before(want.To) {
+		missing = append(missing, TimeRange{cursor, want.To})
+	}
+
+	return missing
+}
@@ -0,0 +1,87 @@
+package gxtb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// chartServer answers chart range requests with one M1 bar per minute and
+// records the requested ranges.
+type chartServer struct {
+	MarketData
+	requests []TimeRange
+}
+
+func (s *chartServer) GetChartRangeRequest(ctx context.Context, info ChartRangeInfo) (ChartData, error) {
+
+	from, to := time.UnixMilli(int64(info.Start)), time.UnixMilli(int64(info.End))
+	s.requests = append(s.requests, TimeRange{from.UTC(), to.UTC()})
+
+	data := ChartData{Digits: 5}
+	for t := from; t.Before(to); t = t.Add(time.Minute) {
+		data.RateInfos = append(data.RateInfos, RateInfo{Ctm: t.UnixMilli(), Open: 110000, High: 5, Low: -5, Close: 1})
+	}
+
+	return data, nil
+}
+
+func TestCachedHistoryDownloadsOnlyGaps(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 1, 8, hour, min, 0, 0, time.UTC)
+	}
+
+	server := &chartServer{}
+	downloader := NewHistoryDownloader(server, HistoryOptions{MaxBarsPerRequest: 1000})
+	downloader.SetClock(fixedClock(now))
+
+	store, err := NewFileBarStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBarStore: %v", err)
+	}
+	history := NewCachedHistory(downloader, store)
+
+	requests := []struct {
+		from, to   time.Time
+		bars       int
+		downloaded []TimeRange
+	}{
+		{at(10, 0), at(11, 0), 60, []TimeRange{{at(10, 0), at(11, 0)}}},
+		{at(10, 30), at(11, 30), 60, []TimeRange{{at(11, 0), at(11, 30)}}},
+		{at(9, 30), at(11, 30), 120, []TimeRange{{at(9, 30), at(10, 0)}}},
+		{at(10, 0), at(11, 0), 60, nil},
+		// The bar of 11:59 is still forming and downloaded again
+		{at(11, 30), at(12, 0), 30, []TimeRange{{at(11, 30), at(12, 0)}}},
+		{at(11, 30), at(12, 0), 30, []TimeRange{{at(11, 59), at(12, 0)}}},
+	}
+
+	for _, r := range requests {
+		server.requests = nil
+
+		bars, err := history.Bars(ctx, "EURUSD", PERIOD_M1, r.from, r.to)
+		if err != nil {
+			t.Fatalf("Bars(%v, %v): %v", r.from, r.to, err)
+		}
+		if len(bars) != r.bars {
+			t.Errorf("Bars(%v, %v) returned %d bars, want %d", r.from, r.to, len(bars), r.bars)
+		}
+
+		if len(server.requests) != len(r.downloaded) {
+			t.Fatalf("Bars(%v, %v) downloaded %v, want %v", r.from, r.to, server.requests, r.downloaded)
+		}
+		for i := range r.downloaded {
+			if server.requests[i] != r.downloaded[i] {
+				t.Errorf("Bars(%v, %v) downloaded %v, want %v", r.from, r.to, server.requests, r.downloaded)
+			}
+		}
+	}
+}
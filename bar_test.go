@@ -0,0 +1,55 @@
+package gxtb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestBarsFromChartData(t *testing.T) {
+
+	// Return data of getChartRangeRequest as sent by the server
+	response := `{
+		"digits": 4,
+		"rateInfos": [
+			{"close": 1.0, "ctm": 1389362640000, "ctmString": "Jan 10, 2014 3:04:00 PM", "high": 6.0, "low": 0.0, "open": 41848.0, "vol": 0.0},
+			{"close": -3.0, "ctm": 1389362700000, "ctmString": "Jan 10, 2014 3:05:00 PM", "high": 2.0, "low": -5.0, "open": 41849.0, "vol": 12.0}
+		]
+	}`
+
+	var data ChartData
+	if err := json.Unmarshal([]byte(response), &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	bars := BarsFromChartData("EURPLN", PERIOD_M1, data)
+
+	want := []Bar{
+		{Symbol: "EURPLN", Period: PERIOD_M1, Time: time.Date(2014, 1, 10, 14, 4, 0, 0, time.UTC), Open: 4.1848, High: 4.1854, Low: 4.1848, Close: 4.1849, Digits: 4},
+		{Symbol: "EURPLN", Period: PERIOD_M1, Time: time.Date(2014, 1, 10, 14, 5, 0, 0, time.UTC), Open: 4.1849, High: 4.1851, Low: 4.1844, Close: 4.1846, Volume: 12, Digits: 4},
+	}
+	if len(bars) != len(want) {
+		t.Fatalf("got %d bars, want %d", len(bars), len(want))
+	}
+	for i := range want {
+		if bars[i] != want[i] {
+			t.Errorf("bar %d = %+v, want %+v", i, bars[i], want[i])
+		}
+	}
+
+	if end := bars[0].End(); !end.Equal(bars[1].Time) {
+		t.Errorf("first bar ends at %v, want %v", end, bars[1].Time)
+	}
+
+	// Encoding the bars again gives the server values back
+	encoded := ChartDataFromBars(bars)
+	if encoded.Digits != data.Digits {
+		t.Errorf("digits = %d, want %d", encoded.Digits, data.Digits)
+	}
+	for i, r := range encoded.RateInfos {
+		r.CtmString = data.RateInfos[i].CtmString
+		if r != data.RateInfos[i] {
+			t.Errorf("rate info %d = %+v, want %+v", i, r, data.RateInfos[i])
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gxtb
+
+import (
+	"context"
+)
+
+// SymbolSource provides symbol info, implemented by ApiClient and Simulator.
+type SymbolSource interface {
+	GetSymbol(ctx context.Context, symbol string) (SymbolInfo, error)
+	GetAllSymbols(ctx context.Context) ([]SymbolInfo, error)
+}
+
+// MarketData is the market data part of the request api, implemented by ApiClient.
+type MarketData interface {
+	SymbolSource
+	GetCalendar(ctx context.Context) ([]Calendar, error)
+	GetChartLastRequest(ctx context.Context, info ChartLastInfo) (ChartData, error)
+	GetChartRangeRequest(ctx context.Context, info ChartRangeInfo) (ChartData, error)
+	GetNews(ctx context.Context, end, start int) ([]NewsTopic, error)
+	GetServerTime(ctx context.Context) (ServerTime, error)
+	GetTickPrices(ctx context.Context, symbols []string, level, ts int) ([]TickRecord, error)
+	GetTradingHours(ctx context.Context, symbols []string) ([]TradingHours, error)
+}
+
+// Trading sends trade transactions and lists trades, implemented by
+// ApiClient and Simulator.
+type Trading interface {
+	TradeTransaction(ctx context.Context, info TransactionInfo) (OrderId, error)
+	TradeTransactionStatus(ctx context.Context, orderId int) (TransactionStatus, error)
+	GetTrades(ctx context.Context, openedOnly bool) ([]TradeRecord, error)
+	GetTradeRecords(ctx context.Context, orders []int) ([]TradeRecord, error)
+	GetTradesHistory(ctx context.Context, end, start int) ([]TradeRecord, error)
+}
+
+// AccountData provides the account state, implemented by ApiClient and Simulator.
+type AccountData interface {
+	GetCurrentUserData(ctx context.Context) (UserData, error)
+	GetMarginLevel(ctx context.Context) (MarginData, error)
+	GetMarginTrade(ctx context.Context, symbol string, volume float32) (float32, error)
+	GetCommissionDef(ctx context.Context, symbol string, volume float32) (CommissionData, error)
+}
+
+// Broker is everything needed to trade, implemented by ApiClient and
+// Simulator. Components depending on it work unchanged against the server,
+// the simulator or decorators wrapping either.
+type Broker interface {
+	SymbolSource
+	Trading
+	AccountData
+	IsDemo() bool
+}
+
+// MarketDataStream streams prices, implemented by StreamClient and Replayer.
+type MarketDataStream interface {
+	GetTickPrices(ctx context.Context, symbol string, minArrivalTime, maxLevel int, cb GetTickPricesCb) error
+	StopTickPrices(ctx context.Context, symbol string) error
+	GetCandles(ctx context.Context, symbol string, cb GetCandlesCb) error
+	StopCandles(ctx context.Context, symbol string) error
+}
+
+// KeepAliveStream is implemented by StreamClient.
+type KeepAliveStream interface {
+	GetKeepAlive(ctx context.Context, cb GetKeepAliveCb) error
+	StopKeepAlive(ctx context.Context) error
+}
+
+// NewsStream is implemented by StreamClient.
+type NewsStream interface {
+	GetNews(ctx context.Context, cb GetNewsCb) error
+	StopNews(ctx context.Context) error
+}
+
+// TradingStream streams trades and transaction results, implemented by
+// StreamClient and SimulatorStream.
+type TradingStream interface {
+	GetTrades(ctx context.Context, cb GetTradesCb) error
+	StopTrades(ctx context.Context) error
+	GetTradeStatus(ctx context.Context, cb GetTradeStatusCb) error
+	StopTradeStatus(ctx context.Context) error
+}
+
+// AccountStream streams balance and profits, implemented by StreamClient and
+// SimulatorStream.
+type AccountStream interface {
+	GetBalance(ctx context.Context, cb GetBalanceCb) error
+	StopBalance(ctx context.Context) error
+	GetProfits(ctx context.Context, cb GetProfitsCb) error
+	StopProfits(ctx context.Context) error
+}
+
+// BrokerStream is the stream counterpart of Broker, implemented by
+// StreamClient and SimulatorStream.
+type BrokerStream interface {
+	TradingStream
+	AccountStream
+	IsDemo() bool
+}
+
+var (
+	_ MarketData       = (*ApiClient)(nil)
+	_ Broker           = (*ApiClient)(nil)
+	_ Broker           = (*Simulator)(nil)
+	_ Broker           = (*RiskManager)(nil)
+	_ MarketDataStream = (*StreamClient)(nil)
+	_ MarketDataStream = (*Replayer)(nil)
+	_ KeepAliveStream  = (*StreamClient)(nil)
+	_ NewsStream       = (*StreamClient)(nil)
+	_ BrokerStream     = (*StreamClient)(nil)
+	_ BrokerStream     = (*SimulatorStream)(nil)
+	_ Clock            = (*Replayer)(nil)
+	_ Clock            = (*Simulator)(nil)
+)
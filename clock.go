@@ -0,0 +1,19 @@
+package gxtb
+
+import "time"
+
+// Clock tells the time. Components reading the time accept a Clock through
+// SetClock, so a Replayer or Simulator drives them with the time of the
+// replayed data and playback gives reproducible results.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock, the default of all components.
+var SystemClock Clock = systemClock{}
@@ -0,0 +1,444 @@
+package gxtb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Impact int
+
+const (
+	IMPACT_UNKNOWN Impact = iota
+	IMPACT_LOW
+	IMPACT_MEDIUM
+	IMPACT_HIGH
+)
+
+func (i Impact) String() string {
+	switch i {
+	case IMPACT_LOW:
+		return "LOW"
+	case IMPACT_MEDIUM:
+		return "MEDIUM"
+	case IMPACT_HIGH:
+		return "HIGH"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseImpact accepts the numeric levels returned by getCalendar as well as names.
+func ParseImpact(s string) Impact {
+
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "1", "LOW":
+		return IMPACT_LOW
+	case "2", "MEDIUM":
+		return IMPACT_MEDIUM
+	case "3", "HIGH":
+		return IMPACT_HIGH
+	default:
+		return IMPACT_UNKNOWN
+	}
+}
+
+// CalendarValue is a parsed value of a release. Valid is false for values
+// not yet published or not numeric.
+type CalendarValue struct {
+	Value float64
+	Unit  string // Suffix following the number, e.g. "%" or "K"
+	Valid bool
+}
+
+var calendarMultipliers = map[string]float64{
+	"K": 1e3,
+	"M": 1e6,
+	"B": 1e9,
+	"T": 1e12,
+}
+
+// ParseCalendarValue parses values like "1.5%", "-0.3", "215K" or "1,234.5M".
+// Magnitude suffixes are applied to Value, other units are only recorded.
+func ParseCalendarValue(s string) CalendarValue {
+
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" {
+		return CalendarValue{}
+	}
+
+	end := len(s)
+	for end > 0 && !(s[end-1] >= '0' && s[end-1] <= '9') && s[end-1] != '.' {
+		end--
+	}
+
+	value, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return CalendarValue{}
+	}
+
+	unit := strings.TrimSpace(s[end:])
+	if multiplier, exists := calendarMultipliers[strings.ToUpper(unit)]; exists {
+		value *= multiplier
+	}
+
+	return CalendarValue{value, unit, true}
+}
+
+// CalendarEvent is a parsed getCalendar record.
+type CalendarEvent struct {
+	Time     time.Time
+	Country  string
+	Title    string
+	Period   string
+	Impact   Impact
+	Current  CalendarValue
+	Forecast CalendarValue
+	Previous CalendarValue
+}
+
+func ParseCalendarEvent(rec Calendar) CalendarEvent {
+
+	return CalendarEvent{
+		Time:     time.UnixMilli(rec.Time).UTC(),
+		Country:  rec.Country,
+		Title:    rec.Title,
+		Period:   rec.Period,
+		Impact:   ParseImpact(rec.Impact),
+		Current:  ParseCalendarValue(rec.Current),
+		Forecast: ParseCalendarValue(rec.Forecast),
+		Previous: ParseCalendarValue(rec.Previous),
+	}
+}
+
+// Surprise returns the difference of the current value from the forecast.
+func (e CalendarEvent) Surprise() (float64, bool) {
+
+	if !e.Current.Valid || !e.Forecast.Valid {
+		return 0, false
+	}
+
+	return e.Current.Value - e.Forecast.Value, true
+}
+
+func (e CalendarEvent) key() string {
+	return fmt.Sprintf("%d|%s|%s", e.Time.UnixMilli(), e.Country, e.Title)
+}
+
+// CalendarFilter selects events, zero values match everything.
+type CalendarFilter struct {
+	Countries  []string
+	Currencies []string
+	MinImpact  Impact
+	From       time.Time
+	To         time.Time
+}
+
+// DefaultCountryCurrencies maps the calendar country codes to currencies.
+var DefaultCountryCurrencies = map[string]string{
+	"US": "USD", "EU": "EUR", "EMU": "EUR", "DE": "EUR", "FR": "EUR", "IT": "EUR",
+	"ES": "EUR", "NL": "EUR", "AT": "EUR", "BE": "EUR", "IE": "EUR", "PT": "EUR",
+	"FI": "EUR", "GR": "EUR", "SK": "EUR", "GB": "GBP", "UK": "GBP", "JP": "JPY",
+	"CH": "CHF", "CA": "CAD", "AU": "AUD", "NZ": "NZD", "CN": "CNY", "PL": "PLN",
+	"CZ": "CZK", "HU": "HUF", "SE": "SEK", "NO": "NOK", "DK": "DKK", "TR": "TRY",
+	"ZA": "ZAR", "MX": "MXN", "RU": "RUB", "RO": "RON", "HK": "HKD", "SG": "SGD",
+}
+
+type EconomicCalendarOptions struct {
+	CountryCurrencies map[string]string // Country code to currency, DefaultCountryCurrencies when nil
+	RefreshInterval   time.Duration     // Interval of calendar refreshes done by Run, the default when not positive
+	CheckInterval     time.Duration     // Interval in which Run fires due alerts, the default when not positive
+}
+
+func DefaultEconomicCalendarOptions() EconomicCalendarOptions {
+	return EconomicCalendarOptions{
+		CountryCurrencies: DefaultCountryCurrencies,
+		RefreshInterval:   time.Minute * 15,
+		CheckInterval:     time.Second,
+	}
+}
+
+type CalendarAlertCb func(CalendarEvent)
+
+type calendarAlert struct {
+	before time.Duration
+	filter CalendarFilter
+	cb     CalendarAlertCb
+	fired  map[string]time.Time // Release time of alerted events by key
+}
+
+// EconomicCalendar keeps the parsed economic calendar and fires alerts ahead
+// of selected releases.
+type EconomicCalendar struct {
+	api      MarketData
+	opts     EconomicCalendarOptions
+	registry *SymbolRegistry
+	errorCb  func(error)
+	clock    Clock
+
+	mu      sync.Mutex
+	events  []CalendarEvent
+	updated time.Time
+	alerts  []*calendarAlert
+}
+
+func NewEconomicCalendar(api MarketData, opts EconomicCalendarOptions) *EconomicCalendar {
+
+	defaults := DefaultEconomicCalendarOptions()
+	if opts.CountryCurrencies == nil {
+		opts.CountryCurrencies = defaults.CountryCurrencies
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = defaults.RefreshInterval
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaults.CheckInterval
+	}
+
+	return &EconomicCalendar{
+		api:   api,
+		opts:  opts,
+		clock: SystemClock,
+	}
+}
+
+// SetClock replaces the wall clock alerts are timed by, a Replayer given here
+// fires the alerts at the release times of the replayed data.
+func (c *EconomicCalendar) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+// SetSymbolRegistry enables mapping of events to affected symbols.
+func (c *EconomicCalendar) SetSymbolRegistry(registry *SymbolRegistry) {
+	c.registry = registry
+}
+
+// SetErrorCallback receives the refresh errors Run does not return.
+func (c *EconomicCalendar) SetErrorCallback(cb func(error)) {
+	c.errorCb = cb
+}
+
+// Refresh reloads the calendar from the api.
+func (c *EconomicCalendar) Refresh(ctx context.Context) error {
+
+	records, err := c.api.GetCalendar(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to refresh calendar: %w", err)
+	}
+
+	events := make([]CalendarEvent, 0, len(records))
+	for _, rec := range records {
+		events = append(events, ParseCalendarEvent(rec))
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.events = events
+	c.updated = c.clock.Now()
+
+	return nil
+}
+
+// Updated returns the time the calendar was fetched from the api.
+func (c *EconomicCalendar) Updated() time.Time {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.updated
+}
+
+// Events returns the events matching the filter sorted by time.
+func (c *EconomicCalendar) Events(filter CalendarFilter) []CalendarEvent {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var events []CalendarEvent
+	for _, event := range c.events {
+		if c.match(filter, event) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// Currency returns the currency affected by the event, empty when unknown.
+func (c *EconomicCalendar) Currency(event CalendarEvent) string {
+	return c.opts.CountryCurrencies[strings.ToUpper(event.Country)]
+}
+
+// Symbols returns the symbols quoted in the currency affected by the event.
+// A symbol registry must be set.
+func (c *EconomicCalendar) Symbols(event CalendarEvent) []string {
+
+	currency := c.Currency(event)
+	if currency == "" || c.registry == nil {
+		return nil
+	}
+
+	var symbols []string
+	for _, info := range c.registry.ByCurrency(currency) {
+		symbols = append(symbols, info.Symbol)
+	}
+
+	return symbols
+}
+
+// Blackout returns the first event matching the filter whose release is
+// within before and after of t. Strategies can use it to pause trading.
+func (c *EconomicCalendar) Blackout(filter CalendarFilter, t time.Time, before, after time.Duration) (CalendarEvent, bool) {
+
+	filter.From = t.Add(-after)
+	filter.To = t.Add(before)
+
+	events := c.Events(filter)
+	if len(events) == 0 {
+		return CalendarEvent{}, false
+	}
+
+	return events[0], true
+}
+
+// BlackoutSymbol is Blackout for events affecting either currency of the symbol.
+func (c *EconomicCalendar) BlackoutSymbol(info SymbolInfo, minImpact Impact, t time.Time, before, after time.Duration) (CalendarEvent, bool) {
+
+	filter := CalendarFilter{
+		Currencies: []string{info.Currency, info.CurrencyProfit},
+		MinImpact:  minImpact,
+	}
+
+	return c.Blackout(filter, t, before, after)
+}
+
+// OnEvent registers a callback fired once per matching event, before ahead of
+// its release. The callbacks are fired by Run.
+func (c *EconomicCalendar) OnEvent(before time.Duration, filter CalendarFilter, cb CalendarAlertCb) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.alerts = append(c.alerts, &calendarAlert{
+		before: before,
+		filter: filter,
+		cb:     cb,
+		fired:  make(map[string]time.Time),
+	})
+}
+
+// Run refreshes the calendar and fires alerts until the context is canceled.
+// When a refresh fails, alerts keep firing from the calendar loaded last.
+func (c *EconomicCalendar) Run(ctx context.Context) error {
+
+	c.refresh(ctx)
+	c.FireAlerts()
+
+	refresh := time.NewTicker(c.opts.RefreshInterval)
+	defer refresh.Stop()
+
+	check := time.NewTicker(c.opts.CheckInterval)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-refresh.C:
+			c.refresh(ctx)
+		case <-check.C:
+		}
+		c.FireAlerts()
+	}
+}
+
+func (c *EconomicCalendar) refresh(ctx context.Context) {
+
+	if err := c.Refresh(ctx); err != nil && c.errorCb != nil {
+		c.errorCb(err)
+	}
+}
+
+// FireAlerts fires the alerts due at the time of the clock. Run calls it in
+// CheckInterval, a replay calls it from Replayer.OnClock.
+func (c *EconomicCalendar) FireAlerts() {
+
+	type due struct {
+		cb    CalendarAlertCb
+		event CalendarEvent
+	}
+
+	var fire []due
+
+	c.mu.Lock()
+	now := c.clock.Now()
+	for _, alert := range c.alerts {
+		for _, event := range c.events {
+			// Events already released are not alerted when Run starts late
+			if now.Before(event.Time.Add(-alert.before)) || !now.Before(event.Time) {
+				continue
+			}
+			if _, fired := alert.fired[event.key()]; fired || !c.match(alert.filter, event) {
+				continue
+			}
+			alert.fired[event.key()] = event.Time
+			fire = append(fire, due{alert.cb, event})
+		}
+		for key, released := range alert.fired {
+			if now.After(released) {
+				delete(alert.fired, key)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for _, d := range fire {
+		d.cb(d.event)
+	}
+}
+
+// match must be called with the lock held.
+func (c *EconomicCalendar) match(filter CalendarFilter, event CalendarEvent) bool {
+
+	if event.Impact < filter.MinImpact {
+		return false
+	}
+
+	if !filter.From.IsZero() && event.Time.Before(filter.From) {
+		return false
+	}
+
+	if !filter.To.IsZero() && event.Time.After(filter.To) {
+		return false
+	}
+
+	if len(filter.Countries) > 0 && !containsFold(filter.Countries, event.Country) {
+		return false
+	}
+
+	if len(filter.Currencies) > 0 && !containsFold(filter.Currencies, c.Currency(event)) {
+		return false
+	}
+
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
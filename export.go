@@ -0,0 +1,452 @@
+package gxtb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var ErrUnknownColumn = errors.New("unknown column")
+
+// ExportOptions configures the CSV and JSON Lines writers and readers.
+type ExportOptions struct {
+	Columns    []string       // Columns written and their order, all columns when empty
+	TimeFormat string         // Layout of times, unix milliseconds when empty
+	Location   *time.Location // Location times are formatted and parsed in, UTC when nil
+}
+
+func DefaultExportOptions() ExportOptions {
+	return ExportOptions{}
+}
+
+func WriteBarsCSV(w io.Writer, bars []Bar, opts ExportOptions) error {
+	return writeCSV(w, bars, barColumns, opts)
+}
+
+func WriteBarsJSONL(w io.Writer, bars []Bar, opts ExportOptions) error {
+	return writeJSONL(w, bars, barColumns, opts)
+}
+
+func ReadBarsCSV(r io.Reader, opts ExportOptions) ([]Bar, error) {
+	return readCSV(r, barColumns, opts)
+}
+
+func ReadBarsJSONL(r io.Reader, opts ExportOptions) ([]Bar, error) {
+	return readJSONL(r, barColumns, opts)
+}
+
+// WriteChartDataCSV writes the decoded bars of a chart request.
+func WriteChartDataCSV(w io.Writer, symbol string, period Period, data ChartData, opts ExportOptions) error {
+	return WriteBarsCSV(w, BarsFromChartData(symbol, period, data), opts)
+}
+
+func WriteChartDataJSONL(w io.Writer, symbol string, period Period, data ChartData, opts ExportOptions) error {
+	return WriteBarsJSONL(w, BarsFromChartData(symbol, period, data), opts)
+}
+
+func WriteTickPricesCSV(w io.Writer, ticks []TickPrice, opts ExportOptions) error {
+	return writeCSV(w, ticks, tickPriceColumns, opts)
+}
+
+func WriteTickPricesJSONL(w io.Writer, ticks []TickPrice, opts ExportOptions) error {
+	return writeJSONL(w, ticks, tickPriceColumns, opts)
+}
+
+func ReadTickPricesCSV(r io.Reader, opts ExportOptions) ([]TickPrice, error) {
+	return readCSV(r, tickPriceColumns, opts)
+}
+
+func ReadTickPricesJSONL(r io.Reader, opts ExportOptions) ([]TickPrice, error) {
+	return readJSONL(r, tickPriceColumns, opts)
+}
+
+func WriteTradeRecordsCSV(w io.Writer, trades []TradeRecord, opts ExportOptions) error {
+	return writeCSV(w, trades, tradeRecordColumns, opts)
+}
+
+func WriteTradeRecordsJSONL(w io.Writer, trades []TradeRecord, opts ExportOptions) error {
+	return writeJSONL(w, trades, tradeRecordColumns, opts)
+}
+
+func ReadTradeRecordsCSV(r io.Reader, opts ExportOptions) ([]TradeRecord, error) {
+	return readCSV(r, tradeRecordColumns, opts)
+}
+
+func ReadTradeRecordsJSONL(r io.Reader, opts ExportOptions) ([]TradeRecord, error) {
+	return readJSONL(r, tradeRecordColumns, opts)
+}
+
+// column maps one field of T to a named column. The value returned by get is
+// one of float64, int64, string, bool, time.Time or nil.
+type column[T any] struct {
+	name string
+	get  func(*T) any
+	set  func(*T, string, ExportOptions) error
+}
+
+var barColumns = []column[Bar]{
+	stringColumn("symbol", func(b *Bar) *string { return &b.Symbol }),
+	{
+		name: "period",
+		get:  func(b *Bar) any { return int64(b.Period) },
+		set: func(b *Bar, s string, _ ExportOptions) error {
+			v, err := strconv.Atoi(s)
+			b.Period = Period(v)
+			return err
+		},
+	},
+	{
+		name: "time",
+		get:  func(b *Bar) any { return b.Time },
+		set: func(b *Bar, s string, opts ExportOptions) error {
+			t, err := parseExportTime(s, opts)
+			b.Time = t.UTC()
+			return err
+		},
+	},
+	floatColumn("open", func(b *Bar) *float64 { return &b.Open }),
+	floatColumn("high", func(b *Bar) *float64 { return &b.High }),
+	floatColumn("low", func(b *Bar) *float64 { return &b.Low }),
+	floatColumn("close", func(b *Bar) *float64 { return &b.Close }),
+	floatColumn("volume", func(b *Bar) *float64 { return &b.Volume }),
+	intColumn("digits", func(b *Bar) *int { return &b.Digits }),
+}
+
+var tickPriceColumns = []column[TickPrice]{
+	stringColumn("symbol", func(t *TickPrice) *string { return &t.Symbol }),
+	timeColumn("timestamp", func(t *TickPrice) *int64 { return &t.Timestamp }),
+	intColumn("level", func(t *TickPrice) *int { return &t.Level }),
+	floatColumn("bid", func(t *TickPrice) *float64 { return &t.Bid }),
+	floatColumn("ask", func(t *TickPrice) *float64 { return &t.Ask }),
+	intColumn("bidVolume", func(t *TickPrice) *int { return &t.BidVolume }),
+	intColumn("askVolume", func(t *TickPrice) *int { return &t.AskVolume }),
+	floatColumn("high", func(t *TickPrice) *float64 { return &t.High }),
+	floatColumn("low", func(t *TickPrice) *float64 { return &t.Low }),
+	floatColumn("spreadRaw", func(t *TickPrice) *float64 { return &t.SpreadRaw }),
+	floatColumn("spreadTable", func(t *TickPrice) *float64 { return &t.SpreadTable }),
+	intColumn("quoteId", func(t *TickPrice) *int { return &t.QuoteId }),
+}
+
+var tradeRecordColumns = []column[TradeRecord]{
+	intColumn("order", func(t *TradeRecord) *int { return &t.Order }),
+	intColumn("order2", func(t *TradeRecord) *int { return &t.Order2 }),
+	intColumn("position", func(t *TradeRecord) *int { return &t.Position }),
+	stringColumn("symbol", func(t *TradeRecord) *string { return &t.Symbol }),
+	intColumn("cmd", func(t *TradeRecord) *int { return &t.Cmd }),
+	floatColumn("volume", func(t *TradeRecord) *float64 { return &t.Volume }),
+	intColumn("digits", func(t *TradeRecord) *int { return &t.Digits }),
+	timeColumn("open_time", func(t *TradeRecord) *int64 { return &t.OpenTime }),
+	floatColumn("open_price", func(t *TradeRecord) *float64 { return &t.OpenPrice }),
+	nullableTimeColumn("close_time", func(t *TradeRecord) **int64 { return &t.CloseTime }),
+	floatColumn("close_price", func(t *TradeRecord) *float64 { return &t.ClosePrice }),
+	boolColumn("closed", func(t *TradeRecord) *bool { return &t.Closed }),
+	floatColumn("sl", func(t *TradeRecord) *float64 { return &t.SL }),
+	floatColumn("tp", func(t *TradeRecord) *float64 { return &t.TP }),
+	nullableTimeColumn("expiration", func(t *TradeRecord) **int64 { return &t.Expiration }),
+	intColumn("offset", func(t *TradeRecord) *int { return &t.Offset }),
+	floatColumn("profit", func(t *TradeRecord) *float64 { return &t.Profit }),
+	floatColumn("commission", func(t *TradeRecord) *float64 { return &t.Commission }),
+	floatColumn("storage", func(t *TradeRecord) *float64 { return &t.Storage }),
+	floatColumn("margin_rate", func(t *TradeRecord) *float64 { return &t.MarginRate }),
+	stringColumn("comment", func(t *TradeRecord) *string { return &t.Comment }),
+	stringColumn("customComment", func(t *TradeRecord) *string { return &t.CustomComment }),
+	timeColumn("timestamp", func(t *TradeRecord) *int64 { return &t.Timestamp }),
+}
+
+func stringColumn[T any](name string, field func(*T) *string) column[T] {
+	return column[T]{
+		name: name,
+		get:  func(r *T) any { return *field(r) },
+		set: func(r *T, s string, _ ExportOptions) error {
+			*field(r) = s
+			return nil
+		},
+	}
+}
+
+func floatColumn[T any](name string, field func(*T) *float64) column[T] {
+	return column[T]{
+		name: name,
+		get:  func(r *T) any { return *field(r) },
+		set: func(r *T, s string, _ ExportOptions) error {
+			v, err := strconv.ParseFloat(s, 64)
+			*field(r) = v
+			return err
+		},
+	}
+}
+
+func intColumn[T any](name string, field func(*T) *int) column[T] {
+	return column[T]{
+		name: name,
+		get:  func(r *T) any { return int64(*field(r)) },
+		set: func(r *T, s string, _ ExportOptions) error {
+			v, err := strconv.Atoi(s)
+			*field(r) = v
+			return err
+		},
+	}
+}
+
+func boolColumn[T any](name string, field func(*T) *bool) column[T] {
+	return column[T]{
+		name: name,
+		get:  func(r *T) any { return *field(r) },
+		set: func(r *T, s string, _ ExportOptions) error {
+			v, err := strconv.ParseBool(s)
+			*field(r) = v
+			return err
+		},
+	}
+}
+
+// timeColumn exports a unix milliseconds field as a time.
+func timeColumn[T any](name string, field func(*T) *int64) column[T] {
+	return column[T]{
+		name: name,
+		get:  func(r *T) any { return time.UnixMilli(*field(r)) },
+		set: func(r *T, s string, opts ExportOptions) error {
+			t, err := parseExportTime(s, opts)
+			*field(r) = t.UnixMilli()
+			return err
+		},
+	}
+}
+
+func nullableTimeColumn[T any](name string, field func(*T) **int64) column[T] {
+	return column[T]{
+		name: name,
+		get: func(r *T) any {
+			if *field(r) == nil {
+				return nil
+			}
+			return time.UnixMilli(**field(r))
+		},
+		set: func(r *T, s string, opts ExportOptions) error {
+			if s == "" {
+				*field(r) = nil
+				return nil
+			}
+			t, err := parseExportTime(s, opts)
+			ms := t.UnixMilli()
+			*field(r) = &ms
+			return err
+		},
+	}
+}
+
+func selectColumns[T any](all []column[T], names []string) ([]column[T], error) {
+
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	selected := make([]column[T], 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, col := range all {
+			if col.name == name {
+				selected = append(selected, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownColumn, name)
+		}
+	}
+
+	return selected, nil
+}
+
+func formatExportValue(v any, opts ExportOptions) string {
+
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	case time.Time:
+		if opts.TimeFormat == "" {
+			return strconv.FormatInt(v.UnixMilli(), 10)
+		}
+		return v.In(exportLocation(opts)).Format(opts.TimeFormat)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseExportTime(s string, opts ExportOptions) (time.Time, error) {
+
+	if opts.TimeFormat == "" {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		return time.UnixMilli(ms), err
+	}
+
+	return time.ParseInLocation(opts.TimeFormat, s, exportLocation(opts))
+}
+
+func exportLocation(opts ExportOptions) *time.Location {
+
+	if opts.Location == nil {
+		return time.UTC
+	}
+
+	return opts.Location
+}
+
+func writeCSV[T any](w io.Writer, records []T, all []column[T], opts ExportOptions) error {
+
+	cols, err := selectColumns(all, opts.Columns)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+
+	row := make([]string, len(cols))
+	for i, col := range cols {
+		row[i] = col.name
+	}
+	if err := cw.Write(row); err != nil {
+		return fmt.Errorf("unable to write csv header: %w", err)
+	}
+
+	for i := range records {
+		for j, col := range cols {
+			row[j] = formatExportValue(col.get(&records[i]), opts)
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("unable to write csv row %d: %w", i, err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV[T any](r io.Reader, all []column[T], opts ExportOptions) ([]T, error) {
+
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read csv header: %w", err)
+	}
+
+	cols, err := selectColumns(all, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []T
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("unable to read csv line %d: %w", line, err)
+		}
+
+		var rec T
+		for i, col := range cols {
+			if err := col.set(&rec, row[i], opts); err != nil {
+				return records, fmt.Errorf("unable to parse %s on csv line %d: %w", col.name, line, err)
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+func writeJSONL[T any](w io.Writer, records []T, all []column[T], opts ExportOptions) error {
+
+	cols, err := selectColumns(all, opts.Columns)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for i := range records {
+		bw.WriteByte('{')
+		for j, col := range cols {
+			if j > 0 {
+				bw.WriteByte(',')
+			}
+			name, _ := json.Marshal(col.name)
+			bw.Write(name)
+			bw.WriteByte(':')
+
+			var value []byte
+			switch v := col.get(&records[i]).(type) {
+			case time.Time:
+				if opts.TimeFormat == "" {
+					value, err = json.Marshal(v.UnixMilli())
+				} else {
+					value, err = json.Marshal(formatExportValue(v, opts))
+				}
+			default:
+				value, err = json.Marshal(v)
+			}
+			if err != nil {
+				return fmt.Errorf("unable to marshal %s of record %d: %w", col.name, i, err)
+			}
+			bw.Write(value)
+		}
+		bw.WriteString("}\n")
+	}
+
+	return bw.Flush()
+}
+
+func readJSONL[T any](r io.Reader, all []column[T], opts ExportOptions) ([]T, error) {
+
+	dec := json.NewDecoder(r)
+
+	var records []T
+	for line := 1; ; line++ {
+		var obj map[string]json.RawMessage
+		if err := dec.Decode(&obj); errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return records, fmt.Errorf("unable to decode json line %d: %w", line, err)
+		}
+
+		var rec T
+		for name, raw := range obj {
+			cols, err := selectColumns(all, []string{name})
+			if err != nil {
+				return records, fmt.Errorf("unable to decode json line %d: %w", line, err)
+			}
+
+			var text string
+			if err := json.Unmarshal(raw, &text); err != nil {
+				// Not a string, numbers, booleans and null are used verbatim
+				text = string(raw)
+				if text == "null" {
+					text = ""
+				}
+			}
+
+			if err := cols[0].set(&rec, text, opts); err != nil {
+				return records, fmt.Errorf("unable to parse %s on json line %d: %w", name, line, err)
+			}
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,74 @@
+package gxtb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteChartDataCSV(t *testing.T) {
+
+	data := ChartData{Digits: 5, RateInfos: []RateInfo{
+		{Ctm: time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC).UnixMilli(), Open: 110012, High: 25, Low: -10, Close: 12, Vol: 150},
+		{Ctm: time.Date(2024, 1, 8, 12, 1, 0, 0, time.UTC).UnixMilli(), Open: 110024, High: 3, Low: -20, Close: -7, Vol: 98},
+	}}
+
+	opts := ExportOptions{
+		Columns:    []string{"time", "open", "close", "volume"},
+		TimeFormat: "2006-01-02 15:04",
+		Location:   time.FixedZone("CET", 3600),
+	}
+
+	var buf bytes.Buffer
+	if err := WriteChartDataCSV(&buf, "EURUSD", PERIOD_M1, data, opts); err != nil {
+		t.Fatalf("WriteChartDataCSV: %v", err)
+	}
+
+	want := "time,open,close,volume\n" +
+		"2024-01-08 13:00,1.10012,1.10024,150\n" +
+		"2024-01-08 13:01,1.10024,1.10017,98\n"
+	if buf.String() != want {
+		t.Errorf("csv =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	bars, err := ReadBarsCSV(&buf, opts)
+	if err != nil {
+		t.Fatalf("ReadBarsCSV: %v", err)
+	}
+	if len(bars) != 2 || !bars[1].Time.Equal(time.UnixMilli(data.RateInfos[1].Ctm)) || bars[1].Close != 1.10017 {
+		t.Errorf("ReadBarsCSV = %+v", bars)
+	}
+
+	opts.Columns = []string{"time", "spread"}
+	if err := WriteChartDataCSV(&buf, "EURUSD", PERIOD_M1, data, opts); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("unknown column: %v, want ErrUnknownColumn", err)
+	}
+}
+
+func TestTradeRecordsRoundTrip(t *testing.T) {
+
+	closeTime := time.Date(2024, 1, 8, 14, 30, 0, 0, time.UTC).UnixMilli()
+	expiration := time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+	trades := []TradeRecord{
+		{Order: 7, Order2: 6, Position: 7, Symbol: "EURUSD", Cmd: int(CMD_BUY), Volume: 0.4, Digits: 5, OpenTime: time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC).UnixMilli(), OpenPrice: 1.10012, CloseTime: &closeTime, ClosePrice: 1.1012, Closed: true, SL: 1.099, TP: 1.102, Profit: 43.2, Commission: -1.5, Storage: -0.3, MarginRate: 880, Comment: "[S/L]", CustomComment: `gx-1, "quoted"`, Timestamp: closeTime},
+		{Order: 8, Position: 8, Symbol: "US500", Cmd: int(CMD_SELL_LIMIT), Volume: 1, Digits: 2, OpenPrice: 4810.5, Expiration: &expiration, Timestamp: closeTime},
+	}
+
+	var csv, jsonl bytes.Buffer
+	if err := WriteTradeRecordsCSV(&csv, trades, DefaultExportOptions()); err != nil {
+		t.Fatalf("WriteTradeRecordsCSV: %v", err)
+	}
+	if err := WriteTradeRecordsJSONL(&jsonl, trades, DefaultExportOptions()); err != nil {
+		t.Fatalf("WriteTradeRecordsJSONL: %v", err)
+	}
+
+	if got, err := ReadTradeRecordsCSV(&csv, DefaultExportOptions()); err != nil || !reflect.DeepEqual(got, trades) {
+		t.Errorf("ReadTradeRecordsCSV = %+v, %v, want %+v", got, err, trades)
+	}
+	if got, err := ReadTradeRecordsJSONL(&jsonl, DefaultExportOptions()); err != nil || !reflect.DeepEqual(got, trades) {
+		t.Errorf("ReadTradeRecordsJSONL = %+v, %v, want %+v", got, err, trades)
+	}
+}
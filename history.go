@@ -0,0 +1,150 @@
+package gxtb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type HistoryOptions struct {
+	MaxBarsPerRequest int           // Bars requested at most in one getChartRangeRequest, the default when not positive
+	RequestInterval   time.Duration // Minimum time between two requests
+}
+
+func DefaultHistoryOptions() HistoryOptions {
+	return HistoryOptions{
+		MaxBarsPerRequest: 1000,
+		RequestInterval:   time.Millisecond * 200,
+	}
+}
+
+// HistoryDownloader downloads chart history of any length by splitting it
+// into requests the broker accepts.
+type HistoryDownloader struct {
+	api   MarketData
+	opts  HistoryOptions
+	clock Clock
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func NewHistoryDownloader(api MarketData, opts HistoryOptions) *HistoryDownloader {
+
+	if opts.MaxBarsPerRequest <= 0 {
+		opts.MaxBarsPerRequest = DefaultHistoryOptions().MaxBarsPerRequest
+	}
+
+	return &HistoryDownloader{
+		api:   api,
+		opts:  opts,
+		clock: SystemClock,
+	}
+}
+
+// SetClock makes the limits of available history follow the clock, e.g. a
+// Replayer, instead of the wall clock.
+func (h *HistoryDownloader) SetClock(clock Clock) {
+	h.clock = clock
+}
+
+// Bars downloads the bars opened in [from, to) sorted by time. The broker keeps
+// only limited history for short periods (M1 to M15 one month, M30 and H1
+// seven months, H4 thirteen months), from is moved forward to what is available.
+func (h *HistoryDownloader) Bars(ctx context.Context, symbol string, period Period, from, to time.Time) ([]Bar, error) {
+
+	step := period.Duration()
+	if step <= 0 {
+		return nil, fmt.Errorf("%w: unable to download %s history of %s", ErrInvalidPeriod, symbol, period)
+	}
+
+	maxBars := h.opts.MaxBarsPerRequest
+	if maxBars <= 0 {
+		maxBars = DefaultHistoryOptions().MaxBarsPerRequest
+	}
+	chunk := step * time.Duration(maxBars)
+
+	if available := h.AvailableFrom(period); from.Before(available) {
+		from = available
+	}
+
+	seen := make(map[int64]bool)
+	var bars []Bar
+
+	for start := from; start.Before(to); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+
+		if err := h.wait(ctx); err != nil {
+			return bars, err
+		}
+
+		data, err := h.api.GetChartRangeRequest(ctx, ChartRangeInfo{
+			Period: period,
+			Start:  int(start.UnixMilli()),
+			End:    int(end.UnixMilli()),
+			Symbol: symbol,
+		})
+		if err != nil {
+			return bars, fmt.Errorf("unable to download %s history from %v: %w", symbol, start, err)
+		}
+
+		for _, bar := range BarsFromChartData(symbol, period, data) {
+			ms := bar.Time.UnixMilli()
+			if seen[ms] || bar.Time.Before(from) || !bar.Time.Before(to) {
+				continue
+			}
+			seen[ms] = true
+			bars = append(bars, bar)
+		}
+	}
+
+	sort.Slice(bars, func(i, j int) bool {
+		return bars[i].Time.Before(bars[j].Time)
+	})
+
+	return bars, nil
+}
+
+// AvailableFrom returns the oldest time Bars downloads for the period.
+func (h *HistoryDownloader) AvailableFrom(period Period) time.Time {
+	return availableFrom(period, h.clock.Now())
+}
+
+// wait enforces the interval between requests.
+func (h *HistoryDownloader) wait(ctx context.Context) error {
+
+	h.mu.Lock()
+	delay := time.Until(h.last.Add(h.opts.RequestInterval))
+	h.last = time.Now().Add(max(delay, 0))
+	h.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+func availableFrom(period Period, now time.Time) time.Time {
+
+	switch {
+	case period < PERIOD_M30:
+		return now.AddDate(0, -1, 0)
+	case period < PERIOD_H4:
+		return now.AddDate(0, -7, 0)
+	case period < PERIOD_D1:
+		return now.AddDate(0, -13, 0)
+	default:
+		return time.Time{}
+	}
+}
@@ -0,0 +1,192 @@
+package gxtb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrSubmitUncertain = errors.New("unable to determine whether the order was submitted")
+
+type IdempotentOptions struct {
+	Attempts      int           // Maximum number of sends of one order
+	SettleDelay   time.Duration // Time given to the server before looking the key up, and between lookups
+	LookupTimeout time.Duration // Time the key is looked up for before the order is sent again
+	HistoryWindow time.Duration // How far back the trades history is searched for the key
+}
+
+func DefaultIdempotentOptions() IdempotentOptions {
+	return IdempotentOptions{
+		Attempts:      3,
+		SettleDelay:   time.Millisecond * 500,
+		LookupTimeout: time.Second * 5,
+		HistoryWindow: time.Hour,
+	}
+}
+
+// IdempotentSubmitter sends orders at most once. Each order is stamped with a
+// unique key in CustomComment. When a transaction is not answered
+// (ErrNoResponse), the key is searched for in the trade status stream, open
+// trades and recent history until LookupTimeout passes, only then the order is
+// sent again. An order the server accepts even later is duplicated, no client
+// can tell it from a lost one. All other errors are definite rejections and
+// returned as they are.
+type IdempotentSubmitter struct {
+	api   Trading
+	opts  IdempotentOptions
+	clock Clock
+
+	mu       sync.Mutex
+	statuses map[string]*TradeStatus // Keys of orders being submitted, nil until a status arrives
+}
+
+func NewIdempotentSubmitter(api Trading, opts IdempotentOptions) *IdempotentSubmitter {
+
+	return &IdempotentSubmitter{
+		api:      api,
+		opts:     opts,
+		clock:    SystemClock,
+		statuses: make(map[string]*TradeStatus),
+	}
+}
+
+// SetClock moves the trade history window searched for late fills to the
+// simulated time when submitting to a Simulator.
+func (s *IdempotentSubmitter) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// NewIdempotencyKey returns a random key suitable for CustomComment.
+func NewIdempotencyKey() string {
+
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		// Fall back to the clock, still unique within one process
+		return fmt.Sprintf("gx-%x", time.Now().UnixNano())
+	}
+
+	return "gx-" + hex.EncodeToString(buf)
+}
+
+// HandleTradeStatus is a GetTradeStatusCb recording the statuses of stamped orders.
+func (s *IdempotentSubmitter) HandleTradeStatus(status TradeStatus) {
+
+	if status.CustomComment == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, submitting := s.statuses[status.CustomComment]; submitting {
+		s.statuses[status.CustomComment] = &status
+	}
+}
+
+// Submit sends the transaction at most once. An empty CustomComment is filled
+// with a new key, a non-empty one is used as the key and must be unique.
+// When the order is found instead of being confirmed, the returned OrderId
+// holds the order number of the found trade.
+func (s *IdempotentSubmitter) Submit(ctx context.Context, info TransactionInfo) (OrderId, error) {
+
+	if info.CustomComment == "" {
+		info.CustomComment = NewIdempotencyKey()
+	}
+	key := info.CustomComment
+
+	s.mu.Lock()
+	s.statuses[key] = nil
+	s.mu.Unlock()
+	defer s.forget(key)
+
+	var lastErr error
+
+	for attempt := 0; attempt < s.opts.Attempts; attempt++ {
+		orderId, err := s.api.TradeTransaction(ctx, info)
+		if err == nil {
+			return orderId, nil
+		}
+
+		if !errors.Is(err, ErrNoResponse) {
+			// The order was refused by the server or before being sent
+			return orderId, err
+		}
+		lastErr = err
+
+		deadline := time.Now().Add(s.opts.LookupTimeout)
+		for {
+			select {
+			case <-ctx.Done():
+				return OrderId{}, fmt.Errorf("%w %s: %w", ErrSubmitUncertain, key, ctx.Err())
+			case <-time.After(s.opts.SettleDelay):
+			}
+
+			orderId, found, err := s.lookup(ctx, key)
+			if err != nil {
+				return OrderId{}, fmt.Errorf("%w %s: %w", ErrSubmitUncertain, key, err)
+			}
+			if found {
+				return orderId, nil
+			}
+			if !time.Now().Before(deadline) {
+				break
+			}
+		}
+	}
+
+	return OrderId{}, fmt.Errorf("unable to submit %s after %d attempts: %w", key, s.opts.Attempts, lastErr)
+}
+
+// lookup searches for the key, reporting whether the order landed.
+func (s *IdempotentSubmitter) lookup(ctx context.Context, key string) (OrderId, bool, error) {
+
+	s.mu.Lock()
+	status := s.statuses[key]
+	s.mu.Unlock()
+
+	if status != nil {
+		switch RequestStatus(status.RequestStatus) {
+		case REQUEST_STATUS_ACCEPTED, REQUEST_STATUS_PENDING:
+			return OrderId{status.Order}, true, nil
+		default:
+			return OrderId{}, false, nil
+		}
+	}
+
+	open, err := s.api.GetTrades(ctx, true)
+	if err != nil {
+		return OrderId{}, false, err
+	}
+
+	for _, rec := range open {
+		if rec.CustomComment == key {
+			return OrderId{rec.Order}, true, nil
+		}
+	}
+
+	now := s.clock.Now()
+	history, err := s.api.GetTradesHistory(ctx, int(now.UnixMilli()), int(now.Add(-s.opts.HistoryWindow).UnixMilli()))
+	if err != nil {
+		return OrderId{}, false, err
+	}
+
+	for _, rec := range history {
+		if rec.CustomComment == key {
+			return OrderId{rec.Order}, true, nil
+		}
+	}
+
+	return OrderId{}, false, nil
+}
+
+func (s *IdempotentSubmitter) forget(key string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.statuses, key)
+}
@@ -0,0 +1,382 @@
+package gxtb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewsItem is the common form of NewsTopic and streamed News.
+type NewsItem struct {
+	Key   string    `json:"key"`
+	Time  time.Time `json:"time"`
+	Title string    `json:"title"`
+	Body  string    `json:"body"`
+}
+
+func NewsItemFromTopic(topic NewsTopic) NewsItem {
+
+	return NewsItem{
+		Key:   topic.Key,
+		Time:  time.UnixMilli(int64(topic.Time)).UTC(),
+		Title: topic.Title,
+		Body:  topic.Body,
+	}
+}
+
+func NewsItemFromNews(news News) NewsItem {
+
+	return NewsItem{
+		Key:   news.Key,
+		Time:  time.UnixMilli(news.Time).UTC(),
+		Title: news.Title,
+		Body:  news.Body,
+	}
+}
+
+// NewsQuery selects archived news, zero values match everything. All
+// keywords must be present, any of the symbols is enough.
+type NewsQuery struct {
+	Keywords []string
+	Symbols  []string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// Match reports whether the title or body matches the keywords and symbols.
+// Symbols also match in the "EUR/USD" form of currency pairs.
+func (q NewsQuery) Match(item NewsItem) bool {
+
+	if !q.From.IsZero() && item.Time.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && !item.Time.Before(q.To) {
+		return false
+	}
+
+	text := strings.ToUpper(item.Title + "\n" + item.Body)
+
+	for _, keyword := range q.Keywords {
+		if !strings.Contains(text, strings.ToUpper(keyword)) {
+			return false
+		}
+	}
+
+	if len(q.Symbols) == 0 {
+		return true
+	}
+
+	for _, symbol := range q.Symbols {
+		symbol = strings.ToUpper(symbol)
+		if strings.Contains(text, symbol) {
+			return true
+		}
+		if len(symbol) == 6 && strings.Contains(text, symbol[:3]+"/"+symbol[3:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type NewsFeedOptions struct {
+	ArchivePath string // JSON Lines file news are appended to, no persistence when empty
+	MaxItems    int    // Oldest news are dropped above the limit, unlimited when zero
+}
+
+func DefaultNewsFeedOptions() NewsFeedOptions {
+	return NewsFeedOptions{
+		MaxItems: 10000,
+	}
+}
+
+type NewsCb func(NewsItem)
+
+// NewsFeed merges news requested from history with the news stream into one
+// de-duplicated, searchable archive. The caller subscribes the news stream to
+// HandleNews before calling Backfill, so nothing is missed in between.
+type NewsFeed struct {
+	api  MarketData
+	opts NewsFeedOptions
+
+	mu    sync.Mutex
+	items map[string]NewsItem
+	cbs   []NewsCb
+	chans []chan NewsItem
+}
+
+func NewNewsFeed(api MarketData, opts NewsFeedOptions) *NewsFeed {
+
+	return &NewsFeed{
+		api:   api,
+		opts:  opts,
+		items: make(map[string]NewsItem),
+	}
+}
+
+// OnNews registers a callback for news not seen before.
+func (f *NewsFeed) OnNews(cb NewsCb) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cbs = append(f.cbs, cb)
+}
+
+// Channel returns a channel of news not seen before. News are dropped when
+// the channel is full, they remain searchable in the archive.
+func (f *NewsFeed) Channel(size int) <-chan NewsItem {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan NewsItem, size)
+	f.chans = append(f.chans, ch)
+	return ch
+}
+
+// Load restores the archive. A missing archive file is not an error.
+func (f *NewsFeed) Load() error {
+
+	if f.opts.ArchivePath == "" {
+		return nil
+	}
+
+	file, err := os.Open(f.opts.ArchivePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open news archive: %w", err)
+	}
+	defer file.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var item NewsItem
+		// A line cut by a crash is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil || item.Key == "" {
+			continue
+		}
+		f.items[item.Key] = item
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read news archive: %w", err)
+	}
+
+	f.trim()
+
+	return nil
+}
+
+// Backfill adds the news between since and until, zero until means now.
+func (f *NewsFeed) Backfill(ctx context.Context, since, until time.Time) error {
+
+	end := 0
+	if !until.IsZero() {
+		end = int(until.UnixMilli())
+	}
+
+	topics, err := f.api.GetNews(ctx, end, int(since.UnixMilli()))
+	if err != nil {
+		return fmt.Errorf("unable to backfill news: %w", err)
+	}
+
+	items := make([]NewsItem, 0, len(topics))
+	for _, topic := range topics {
+		items = append(items, NewsItemFromTopic(topic))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Time.Before(items[j].Time)
+	})
+
+	return f.add(items...)
+}
+
+// HandleNews is a GetNewsCb feeding the streamed news.
+func (f *NewsFeed) HandleNews(news News) {
+	f.add(NewsItemFromNews(news))
+}
+
+// Add adds news to the archive, news with a known key are ignored.
+func (f *NewsFeed) Add(items ...NewsItem) error {
+	return f.add(items...)
+}
+
+func (f *NewsFeed) Get(key string) (NewsItem, bool) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item, exists := f.items[key]
+	return item, exists
+}
+
+func (f *NewsFeed) Len() int {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.items)
+}
+
+// Search returns the archived news matching the query, newest first.
+func (f *NewsFeed) Search(query NewsQuery) []NewsItem {
+
+	f.mu.Lock()
+	var items []NewsItem
+	for _, item := range f.items {
+		if query.Match(item) {
+			items = append(items, item)
+		}
+	}
+	f.mu.Unlock()
+
+	sortNewsNewestFirst(items)
+
+	if query.Limit > 0 && len(items) > query.Limit {
+		items = items[:query.Limit]
+	}
+
+	return items
+}
+
+// Compact rewrites the archive file with the news currently kept, dropping
+// duplicates and news trimmed by MaxItems.
+func (f *NewsFeed) Compact() error {
+
+	if f.opts.ArchivePath == "" {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	items := make([]NewsItem, 0, len(f.items))
+	for _, item := range f.items {
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Time.Before(items[j].Time)
+	})
+
+	var data []byte
+	for _, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("unable to marshal news %s: %w", item.Key, err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	return writeFileAtomic(f.opts.ArchivePath, data)
+}
+
+func (f *NewsFeed) add(items ...NewsItem) error {
+
+	f.mu.Lock()
+
+	var added []NewsItem
+	for _, item := range items {
+		if _, exists := f.items[item.Key]; exists || item.Key == "" {
+			continue
+		}
+		f.items[item.Key] = item
+		added = append(added, item)
+	}
+
+	f.trim()
+
+	err := f.append(added)
+
+	cbs := append([]NewsCb(nil), f.cbs...)
+	chans := append([]chan NewsItem(nil), f.chans...)
+	f.mu.Unlock()
+
+	for _, item := range added {
+		for _, cb := range cbs {
+			cb(item)
+		}
+		for _, ch := range chans {
+			select {
+			case ch <- item:
+			default:
+			}
+		}
+	}
+
+	return err
+}
+
+// append must be called with the lock held.
+func (f *NewsFeed) append(items []NewsItem) error {
+
+	if f.opts.ArchivePath == "" || len(items) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(f.opts.ArchivePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open news archive: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return fmt.Errorf("unable to write news archive: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("unable to write news archive: %w", err)
+	}
+
+	return nil
+}
+
+// trim must be called with the lock held.
+func (f *NewsFeed) trim() {
+
+	if f.opts.MaxItems <= 0 || len(f.items) <= f.opts.MaxItems {
+		return
+	}
+
+	items := make([]NewsItem, 0, len(f.items))
+	for _, item := range f.items {
+		items = append(items, item)
+	}
+
+	sortNewsNewestFirst(items)
+
+	for _, item := range items[f.opts.MaxItems:] {
+		delete(f.items, item.Key)
+	}
+}
+
+func sortNewsNewestFirst(items []NewsItem) {
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].Time.Equal(items[j].Time) {
+			return items[i].Time.After(items[j].Time)
+		}
+		return items[i].Key < items[j].Key
+	})
+}
@@ -0,0 +1,250 @@
+package gxtb
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BookLevel is one level of depth of market, level 0 is the top of the book.
+type BookLevel struct {
+	Level     int
+	Bid       float64
+	BidVolume int
+	Ask       float64
+	AskVolume int
+	QuoteId   int // Source of the price, fixed, float, depth or cross
+	Time      time.Time
+}
+
+// OrderBookSnapshot is a coherent view of the book of one symbol with
+// levels sorted from the top of the book.
+type OrderBookSnapshot struct {
+	Symbol string
+	Time   time.Time // Time of the newest level
+	Levels []BookLevel
+}
+
+func (s OrderBookSnapshot) Spread() float64 {
+
+	if len(s.Levels) == 0 {
+		return 0
+	}
+
+	return s.Levels[0].Ask - s.Levels[0].Bid
+}
+
+func (s OrderBookSnapshot) Mid() float64 {
+
+	if len(s.Levels) == 0 {
+		return 0
+	}
+
+	return (s.Levels[0].Bid + s.Levels[0].Ask) / 2
+}
+
+// Microprice is the top of the book mid weighted by the opposite volumes.
+func (s OrderBookSnapshot) Microprice() float64 {
+
+	if len(s.Levels) == 0 {
+		return 0
+	}
+
+	top := s.Levels[0]
+	total := float64(top.BidVolume + top.AskVolume)
+	if total == 0 {
+		return s.Mid()
+	}
+
+	return (top.Bid*float64(top.AskVolume) + top.Ask*float64(top.BidVolume)) / total
+}
+
+// Depth returns the cumulative bid and ask volume of the first n levels,
+// all levels when n is not positive.
+func (s OrderBookSnapshot) Depth(n int) (bidVolume, askVolume int) {
+
+	for i, level := range s.Levels {
+		if n > 0 && i >= n {
+			break
+		}
+		bidVolume += level.BidVolume
+		askVolume += level.AskVolume
+	}
+
+	return bidVolume, askVolume
+}
+
+// Imbalance returns (bid - ask) / (bid + ask) of the cumulative volume of the
+// first n levels, in the range [-1, 1].
+func (s OrderBookSnapshot) Imbalance(n int) float64 {
+
+	bid, ask := s.Depth(n)
+	if bid+ask == 0 {
+		return 0
+	}
+
+	return float64(bid-ask) / float64(bid+ask)
+}
+
+type OrderBookOptions struct {
+	MaxAge time.Duration // Levels older than this relative to the top of the book are stale
+}
+
+func DefaultOrderBookOptions() OrderBookOptions {
+	return OrderBookOptions{
+		MaxAge: time.Second * 5,
+	}
+}
+
+type OrderBookCb func(OrderBookSnapshot)
+
+// OrderBook assembles per symbol books from the level by level tick prices
+// stream messages. The caller subscribes the tick prices with the wanted
+// maxLevel to HandleTick.
+type OrderBook struct {
+	opts OrderBookOptions
+
+	mu    sync.Mutex
+	books map[string]map[int]BookLevel
+	cbs   []OrderBookCb
+	chans []chan OrderBookSnapshot
+}
+
+func NewOrderBook(opts OrderBookOptions) *OrderBook {
+
+	return &OrderBook{
+		opts:  opts,
+		books: make(map[string]map[int]BookLevel),
+	}
+}
+
+// OnUpdate registers a callback receiving a snapshot after every update.
+func (b *OrderBook) OnUpdate(cb OrderBookCb) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cbs = append(b.cbs, cb)
+}
+
+// Channel returns a channel of snapshots, updates are dropped when it is full.
+func (b *OrderBook) Channel(size int) <-chan OrderBookSnapshot {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan OrderBookSnapshot, size)
+	b.chans = append(b.chans, ch)
+	return ch
+}
+
+// Snapshot returns the current book of the symbol.
+func (b *OrderBook) Snapshot(symbol string) (OrderBookSnapshot, bool) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	levels, exists := b.books[symbol]
+	if !exists {
+		return OrderBookSnapshot{}, false
+	}
+
+	return b.snapshot(symbol, levels), true
+}
+
+// HandleTick is the GetTickPricesCb of the book.
+func (b *OrderBook) HandleTick(tick TickPrice) {
+
+	ts := time.UnixMilli(tick.Timestamp).UTC()
+
+	b.mu.Lock()
+
+	levels, exists := b.books[tick.Symbol]
+	if !exists {
+		levels = make(map[int]BookLevel)
+		b.books[tick.Symbol] = levels
+	}
+
+	// Out of order messages carry an older state of the level
+	if prev, exists := levels[tick.Level]; exists && ts.Before(prev.Time) {
+		b.mu.Unlock()
+		return
+	}
+
+	if tick.Bid == 0 && tick.Ask == 0 {
+		delete(levels, tick.Level)
+	} else {
+		levels[tick.Level] = BookLevel{
+			Level:     tick.Level,
+			Bid:       tick.Bid,
+			BidVolume: tick.BidVolume,
+			Ask:       tick.Ask,
+			AskVolume: tick.AskVolume,
+			QuoteId:   tick.QuoteId,
+			Time:      ts,
+		}
+	}
+
+	snapshot := b.snapshot(tick.Symbol, levels)
+	cbs := append([]OrderBookCb(nil), b.cbs...)
+	chans := append([]chan OrderBookSnapshot(nil), b.chans...)
+
+	b.mu.Unlock()
+
+	for _, cb := range cbs {
+		cb(snapshot)
+	}
+
+	for _, ch := range chans {
+		select {
+		case ch <- snapshot:
+		default:
+		}
+	}
+}
+
+// snapshot builds a coherent book, dropping stale levels and levels which no
+// longer fit behind the top of the book. A level is stale when it is older
+// than MaxAge or was quoted by another source than the top of the book, e.g.
+// depth levels left over after the top switched from depth to cross prices.
+// Must be called with the lock held.
+func (b *OrderBook) snapshot(symbol string, levels map[int]BookLevel) OrderBookSnapshot {
+
+	snapshot := OrderBookSnapshot{Symbol: symbol}
+
+	sorted := make([]BookLevel, 0, len(levels))
+	for _, level := range levels {
+		sorted = append(sorted, level)
+		if level.Time.After(snapshot.Time) {
+			snapshot.Time = level.Time
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Level < sorted[j].Level
+	})
+
+	if len(sorted) == 0 || sorted[0].Level != 0 {
+		return snapshot
+	}
+
+	top := sorted[0]
+	bid, ask := math.Inf(1), math.Inf(-1)
+
+	for _, level := range sorted {
+		if level.Level > 0 && b.opts.MaxAge > 0 && top.Time.Sub(level.Time) > b.opts.MaxAge {
+			continue
+		}
+		if level.QuoteId != top.QuoteId {
+			continue
+		}
+		// Deeper levels must quote worse prices than the levels above them
+		if level.Bid > bid || level.Ask < ask {
+			continue
+		}
+		bid, ask = level.Bid, level.Ask
+		snapshot.Levels = append(snapshot.Levels, level)
+	}
+
+	return snapshot
+}
@@ -0,0 +1,248 @@
+package gxtb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	ErrInvalidSymbol = errors.New("symbol does not match symbol info")
+	ErrInvalidVolume = errors.New("invalid volume")
+	ErrInvalidPrice  = errors.New("invalid price")
+	ErrInvalidStops  = errors.New("invalid stop loss or take profit")
+)
+
+// OrderBuilder assembles a TransactionInfo and validates it against
+// the SymbolInfo of the traded instrument before it is sent.
+type OrderBuilder struct {
+	info TransactionInfo
+}
+
+func MarketBuy(symbol string, volume float64) *OrderBuilder {
+	return newOrderBuilder(symbol, CMD_BUY, TYPE_OPEN, volume, 0)
+}
+
+func MarketSell(symbol string, volume float64) *OrderBuilder {
+	return newOrderBuilder(symbol, CMD_SELL, TYPE_OPEN, volume, 0)
+}
+
+func LimitBuy(symbol string, volume, price float64) *OrderBuilder {
+	return newOrderBuilder(symbol, CMD_BUY_LIMIT, TYPE_OPEN, volume, price)
+}
+
+func LimitSell(symbol string, volume, price float64) *OrderBuilder {
+	return newOrderBuilder(symbol, CMD_SELL_LIMIT, TYPE_OPEN, volume, price)
+}
+
+func StopBuy(symbol string, volume, price float64) *OrderBuilder {
+	return newOrderBuilder(symbol, CMD_BUY_STOP, TYPE_OPEN, volume, price)
+}
+
+func StopSell(symbol string, volume, price float64) *OrderBuilder {
+	return newOrderBuilder(symbol, CMD_SELL_STOP, TYPE_OPEN, volume, price)
+}
+
+// ModifyPosition changes sl/tp of an open position, or price, sl, tp and
+// expiration of a pending order. The cmd must match the one of the order.
+func ModifyPosition(symbol string, cmd TradeCmd, order int) *OrderBuilder {
+	b := newOrderBuilder(symbol, cmd, TYPE_MODIFY, 0, 0)
+	b.info.Order = order
+	return b
+}
+
+// ClosePosition closes the given volume of an open position. The order is
+// TradeRecord.Order of the open position and cmd is the one it was opened with.
+func ClosePosition(symbol string, cmd TradeCmd, order int, volume float64) *OrderBuilder {
+	b := newOrderBuilder(symbol, cmd, TYPE_CLOSE, volume, 0)
+	b.info.Order = order
+	return b
+}
+
+func DeletePending(symbol string, cmd TradeCmd, order int) *OrderBuilder {
+	b := newOrderBuilder(symbol, cmd, TYPE_DELETE, 0, 0)
+	b.info.Order = order
+	return b
+}
+
+func newOrderBuilder(symbol string, cmd TradeCmd, txnType TradeType, volume, price float64) *OrderBuilder {
+
+	return &OrderBuilder{
+		info: TransactionInfo{
+			Cmd:    cmd,
+			Symbol: symbol,
+			Type:   txnType,
+			Volume: volume,
+			Price:  price,
+		},
+	}
+}
+
+func (b *OrderBuilder) Price(price float64) *OrderBuilder {
+	b.info.Price = price
+	return b
+}
+
+func (b *OrderBuilder) Volume(volume float64) *OrderBuilder {
+	b.info.Volume = volume
+	return b
+}
+
+func (b *OrderBuilder) StopLoss(sl float64) *OrderBuilder {
+	b.info.Sl = sl
+	return b
+}
+
+func (b *OrderBuilder) TakeProfit(tp float64) *OrderBuilder {
+	b.info.Tp = tp
+	return b
+}
+
+// Expiration sets the expiration of a pending order, zero time means no expiration.
+func (b *OrderBuilder) Expiration(t time.Time) *OrderBuilder {
+	if t.IsZero() {
+		b.info.Expiration = 0
+	} else {
+		b.info.Expiration = t.UnixMilli()
+	}
+	return b
+}
+
+// Offset sets the server side trailing stop offset in points.
+func (b *OrderBuilder) Offset(points int) *OrderBuilder {
+	b.info.Offset = points
+	return b
+}
+
+func (b *OrderBuilder) Comment(comment string) *OrderBuilder {
+	b.info.CustomComment = comment
+	return b
+}
+
+// Build validates the order against the symbol and returns the transaction
+// with volume and prices rounded to what the broker accepts. Market orders
+// without a price are filled in with the current ask or bid.
+func (b *OrderBuilder) Build(symbol SymbolInfo) (TransactionInfo, error) {
+
+	info := b.info
+
+	if info.Symbol != symbol.Symbol {
+		return info, fmt.Errorf("%w: %s != %s", ErrInvalidSymbol, info.Symbol, symbol.Symbol)
+	}
+
+	if info.Type == TYPE_OPEN || info.Type == TYPE_CLOSE {
+		if err := validateVolume(info.Volume, symbol); err != nil {
+			return info, err
+		}
+	}
+
+	if info.Type == TYPE_OPEN && isMarketCmd(info.Cmd) && info.Price == 0 {
+		if isBuyCmd(info.Cmd) {
+			info.Price = symbol.Ask
+		} else {
+			info.Price = symbol.Bid
+		}
+	}
+
+	info.Price = symbol.RoundPrice(info.Price)
+	info.Sl = symbol.RoundPrice(info.Sl)
+	info.Tp = symbol.RoundPrice(info.Tp)
+
+	if info.Type == TYPE_OPEN || info.Type == TYPE_MODIFY {
+		if err := validateStops(info, symbol); err != nil {
+			return info, err
+		}
+	}
+
+	return info, nil
+}
+
+func (c *ApiClient) PlaceOrder(ctx context.Context, b *OrderBuilder) (OrderId, error) {
+	return PlaceOrder(ctx, c, b)
+}
+
+// PlaceOrder fetches the symbol info, builds the order and sends it.
+func PlaceOrder(ctx context.Context, broker Broker, b *OrderBuilder) (OrderId, error) {
+
+	symbol, err := broker.GetSymbol(ctx, b.info.Symbol)
+	if err != nil {
+		return OrderId{}, fmt.Errorf("unable to place order: %w", err)
+	}
+
+	info, err := b.Build(symbol)
+	if err != nil {
+		return OrderId{}, fmt.Errorf("unable to place order: %w", err)
+	}
+
+	return broker.TradeTransaction(ctx, info)
+}
+
+func validateVolume(volume float64, symbol SymbolInfo) error {
+
+	if volume <= 0 {
+		return fmt.Errorf("%w: %v must be positive", ErrInvalidVolume, volume)
+	}
+
+	if symbol.LotMin > 0 && volume < symbol.LotMin-volumeEpsilon {
+		return fmt.Errorf("%w: %v is below minimum %v", ErrInvalidVolume, volume, symbol.LotMin)
+	}
+
+	if symbol.LotMax > 0 && volume > symbol.LotMax+volumeEpsilon {
+		return fmt.Errorf("%w: %v is above maximum %v", ErrInvalidVolume, volume, symbol.LotMax)
+	}
+
+	if symbol.LotStep > 0 {
+		steps := volume / symbol.LotStep
+		if math.Abs(steps-math.Round(steps)) > volumeEpsilon/symbol.LotStep {
+			return fmt.Errorf("%w: %v is not a multiple of lot step %v", ErrInvalidVolume, volume, symbol.LotStep)
+		}
+	}
+
+	return nil
+}
+
+func validateStops(info TransactionInfo, symbol SymbolInfo) error {
+
+	if info.Price <= 0 {
+		if info.Type == TYPE_OPEN {
+			return fmt.Errorf("%w: %v must be positive", ErrInvalidPrice, info.Price)
+		}
+		// Modification of an open position carries no price, nothing to compare stops to
+		return nil
+	}
+
+	minDistance := symbol.StopsLevel * symbol.Point()
+	buy := isBuyCmd(info.Cmd)
+
+	if info.Sl != 0 {
+		if (buy && info.Sl >= info.Price) || (!buy && info.Sl <= info.Price) {
+			return fmt.Errorf("%w: stop loss %v is on the wrong side of price %v", ErrInvalidStops, info.Sl, info.Price)
+		}
+		if math.Abs(info.Price-info.Sl) < minDistance-symbol.Point()/2 {
+			return fmt.Errorf("%w: stop loss %v is closer than %v to price %v", ErrInvalidStops, info.Sl, minDistance, info.Price)
+		}
+	}
+
+	if info.Tp != 0 {
+		if (buy && info.Tp <= info.Price) || (!buy && info.Tp >= info.Price) {
+			return fmt.Errorf("%w: take profit %v is on the wrong side of price %v", ErrInvalidStops, info.Tp, info.Price)
+		}
+		if math.Abs(info.Tp-info.Price) < minDistance-symbol.Point()/2 {
+			return fmt.Errorf("%w: take profit %v is closer than %v to price %v", ErrInvalidStops, info.Tp, minDistance, info.Price)
+		}
+	}
+
+	return nil
+}
+
+const volumeEpsilon = 1e-9
+
+func isMarketCmd(cmd TradeCmd) bool {
+	return cmd == CMD_BUY || cmd == CMD_SELL
+}
+
+func isBuyCmd(cmd TradeCmd) bool {
+	return cmd == CMD_BUY || cmd == CMD_BUY_LIMIT || cmd == CMD_BUY_STOP
+}
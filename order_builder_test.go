@@ -0,0 +1,71 @@
+package gxtb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuildMarketOrder(t *testing.T) {
+
+	eurusd := SymbolInfo{Symbol: "EURUSD", Bid: 1.1, Ask: 1.10012, Precision: 5, LotMin: 0.01, LotMax: 100, LotStep: 0.01, StopsLevel: 10}
+
+	info, err := MarketBuy("EURUSD", 0.07).
+		StopLoss(1.0991234).
+		TakeProfit(1.1021).
+		Comment("breakout").
+		Build(eurusd)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	want := TransactionInfo{
+		Cmd:           CMD_BUY,
+		CustomComment: "breakout",
+		Price:         1.10012,
+		Sl:            1.09912,
+		Symbol:        "EURUSD",
+		Tp:            1.1021,
+		Type:          TYPE_OPEN,
+		Volume:        0.07,
+	}
+	if info != want {
+		t.Errorf("Build = %+v, want %+v", info, want)
+	}
+
+	// A sell is priced at the bid, modifications of positions carry no price
+	if info, err := MarketSell("EURUSD", 1).Build(eurusd); err != nil || info.Price != eurusd.Bid {
+		t.Errorf("sell price = %v, %v, want %v", info.Price, err, eurusd.Bid)
+	}
+	if _, err := ModifyPosition("EURUSD", CMD_BUY, 7).StopLoss(1.2).Build(eurusd); err != nil {
+		t.Errorf("modify stop loss: %v", err)
+	}
+}
+
+func TestBuildRejects(t *testing.T) {
+
+	eurusd := SymbolInfo{Symbol: "EURUSD", Bid: 1.1, Ask: 1.10012, Precision: 5, LotMin: 0.01, LotMax: 100, LotStep: 0.01, StopsLevel: 10}
+
+	orders := []struct {
+		order *OrderBuilder
+		err   error
+	}{
+		{MarketBuy("GBPUSD", 1), ErrInvalidSymbol},
+		{MarketBuy("EURUSD", 0), ErrInvalidVolume},
+		{MarketBuy("EURUSD", 0.005), ErrInvalidVolume},
+		{MarketBuy("EURUSD", 100.01), ErrInvalidVolume},
+		{MarketBuy("EURUSD", 0.015), ErrInvalidVolume},
+		{ClosePosition("EURUSD", CMD_BUY, 7, 0), ErrInvalidVolume},
+		{MarketBuy("EURUSD", 1).StopLoss(1.1002), ErrInvalidStops},
+		{MarketSell("EURUSD", 1).TakeProfit(1.1001), ErrInvalidStops},
+		{MarketBuy("EURUSD", 1).StopLoss(1.10005), ErrInvalidStops},
+		{LimitBuy("EURUSD", 1, 1.09).TakeProfit(1.0899), ErrInvalidStops},
+		{StopSell("EURUSD", 1, 1.09).StopLoss(1.08), ErrInvalidStops},
+		{LimitSell("EURUSD", 1, 0), ErrInvalidPrice},
+	}
+
+	for _, o := range orders {
+		if _, err := o.order.Build(eurusd); !errors.Is(err, o.err) {
+			t.Errorf("Build(%+v) = %v, want %v", o.order.info, err, o.err)
+		}
+	}
+}
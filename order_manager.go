@@ -0,0 +1,523 @@
+package gxtb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type LinkKind int
+
+const (
+	LINK_OCO     LinkKind = iota // One cancels other, filling a leg deletes the remaining legs
+	LINK_BRACKET                 // Pending entry, sl/tp are applied to the position once filled
+)
+
+var ErrLinkExists = errors.New("order link already exists")
+var ErrLinkNotFound = errors.New("order link not found")
+
+// OrderLink is a group of orders managed together on the client side.
+type OrderLink struct {
+	Id       string   `json:"id"`
+	Kind     LinkKind `json:"kind"`
+	Symbol   string   `json:"symbol"`
+	Orders   []int    `json:"orders"`             // Pending orders of the link, the entry for brackets
+	Sl       float64  `json:"sl,omitempty"`       // Bracket stop loss applied on fill
+	Tp       float64  `json:"tp,omitempty"`       // Bracket take profit applied on fill
+	Filled   int      `json:"filled,omitempty"`   // Order number of the filled leg
+	Position int      `json:"position,omitempty"` // Position opened by the filled leg
+	Created  int64    `json:"created"`            // Unix milliseconds the first leg was placed at
+	Done     bool     `json:"done"`
+}
+
+// OrderManager implements OCO and bracket orders on top of pending orders and
+// the trades stream. Its state is persisted so a restarted process can resume
+// with Load and Resume.
+type OrderManager struct {
+	client    Broker
+	statePath string
+	errorCb   func(error)
+	clock     Clock
+
+	mu    sync.Mutex
+	links map[string]*OrderLink
+}
+
+func NewOrderManager(client Broker, statePath string) *OrderManager {
+
+	return &OrderManager{
+		client:    client,
+		statePath: statePath,
+		clock:     SystemClock,
+		links:     make(map[string]*OrderLink),
+	}
+}
+
+// SetClock stamps new links with the time of a Simulator, whose history
+// Resume searches for fills missed while the process was down.
+func (m *OrderManager) SetClock(clock Clock) {
+	m.clock = clock
+}
+
+// SetErrorCallback is called when deleting a sibling or applying bracket stops
+// fails after a fill, as HandleTrade has no caller to return the error to.
+func (m *OrderManager) SetErrorCallback(cb func(error)) {
+	m.errorCb = cb
+}
+
+// Load restores the links persisted by a previous run. A missing state file
+// is not an error. Resume must be called afterwards to handle the fills that
+// happened while the process was down.
+func (m *OrderManager) Load() error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(m.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read order manager state: %w", err)
+	}
+
+	var links []*OrderLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return fmt.Errorf("unable to unmarshal order manager state: %w", err)
+	}
+
+	for _, link := range links {
+		m.links[link.Id] = link
+	}
+
+	return nil
+}
+
+// Resume checks the open links against the open trades and the history and
+// handles legs filled without HandleTrade seeing them, e.g. while the process
+// was down. It is called after the trades stream was subscribed.
+func (m *OrderManager) Resume(ctx context.Context) error {
+
+	m.mu.Lock()
+	var links []*OrderLink
+	for _, link := range m.links {
+		if !link.Done {
+			links = append(links, link)
+		}
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, link := range links {
+		if err := m.resolve(ctx, link); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Links returns a copy of all managed links.
+func (m *OrderManager) Links() []OrderLink {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	links := make([]OrderLink, 0, len(m.links))
+	for _, link := range m.links {
+		links = append(links, copyLink(link))
+	}
+
+	return links
+}
+
+// PlaceOCO places all legs as pending orders and links them. If a leg cannot
+// be placed, the legs placed so far are deleted again. The link is managed
+// from the first placed leg on, so a leg filled while the others are placed
+// cancels them.
+func (m *OrderManager) PlaceOCO(ctx context.Context, id string, legs ...*OrderBuilder) (OrderLink, error) {
+
+	if len(legs) < 2 {
+		return OrderLink{}, fmt.Errorf("unable to place oco %s: at least two legs required", id)
+	}
+
+	for _, leg := range legs {
+		if isMarketCmd(leg.info.Cmd) || leg.info.Symbol != legs[0].info.Symbol {
+			return OrderLink{}, fmt.Errorf("unable to place oco %s: legs must be pending orders of one symbol", id)
+		}
+	}
+
+	link := &OrderLink{Id: id, Kind: LINK_OCO, Symbol: legs[0].info.Symbol, Created: m.clock.Now().UnixMilli()}
+	if err := m.reserve(link); err != nil {
+		return OrderLink{}, err
+	}
+
+	for i, leg := range legs {
+		orderId, err := PlaceOrder(ctx, m.client, leg)
+
+		m.mu.Lock()
+		done := link.Done
+		if err == nil && !done {
+			link.Orders = append(link.Orders, orderId.Id)
+		}
+		placed := append([]int(nil), link.Orders...)
+		m.mu.Unlock()
+
+		if done {
+			// A placed leg was filled, its siblings were deleted by HandleTrade
+			if err == nil {
+				if err := m.deleteOrders(ctx, link.Symbol, []int{orderId.Id}, legs[i:]); err != nil {
+					m.reportError(fmt.Errorf("unable to cancel siblings of %s: %w", id, err))
+				}
+			}
+			return m.copyStored(link)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("unable to place oco %s: %w", id, err)
+			if rollbackErr := m.deleteOrders(ctx, link.Symbol, placed, legs); rollbackErr != nil {
+				err = errors.Join(err, fmt.Errorf("unable to delete placed legs of %s: %w", id, rollbackErr))
+			}
+			m.release(id)
+			return OrderLink{}, err
+		}
+	}
+
+	if err := m.persist(); err != nil {
+		return m.copyStored(link)
+	}
+
+	// Fills streamed before the order numbers were known were not matched
+	if err := m.resolve(ctx, link); err != nil {
+		m.reportError(err)
+	}
+
+	return m.copyStored(link)
+}
+
+// PlaceBracket places a pending entry order, the sl and tp are applied to the
+// resulting position as soon as the entry is filled.
+func (m *OrderManager) PlaceBracket(ctx context.Context, id string, entry *OrderBuilder, sl, tp float64) (OrderLink, error) {
+
+	if isMarketCmd(entry.info.Cmd) {
+		return OrderLink{}, fmt.Errorf("unable to place bracket %s: entry must be a pending order", id)
+	}
+
+	link := &OrderLink{Id: id, Kind: LINK_BRACKET, Symbol: entry.info.Symbol, Sl: sl, Tp: tp, Created: m.clock.Now().UnixMilli()}
+	if err := m.reserve(link); err != nil {
+		return OrderLink{}, err
+	}
+
+	orderId, err := PlaceOrder(ctx, m.client, entry)
+	if err != nil {
+		m.release(id)
+		return OrderLink{}, fmt.Errorf("unable to place bracket %s: %w", id, err)
+	}
+
+	m.mu.Lock()
+	link.Orders = []int{orderId.Id}
+	m.mu.Unlock()
+
+	if err := m.persist(); err != nil {
+		return m.copyStored(link)
+	}
+
+	// A fill streamed before the order number was known was not matched
+	if err := m.resolve(ctx, link); err != nil {
+		m.reportError(err)
+	}
+
+	return m.copyStored(link)
+}
+
+// Cancel deletes all unfilled orders of the link and stops managing it.
+func (m *OrderManager) Cancel(ctx context.Context, id string) error {
+
+	m.mu.Lock()
+	link, exists := m.links[id]
+	var orders []int
+	if exists {
+		for _, order := range link.Orders {
+			if order != link.Filled {
+				orders = append(orders, order)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrLinkNotFound, id)
+	}
+
+	if err := m.deleteOrders(ctx, link.Symbol, orders, nil); err != nil {
+		return fmt.Errorf("unable to cancel %s: %w", id, err)
+	}
+
+	m.mu.Lock()
+	delete(m.links, id)
+	err := m.save()
+	m.mu.Unlock()
+
+	return err
+}
+
+// HandleTrade is a GetTradesCb which reacts to fills of managed orders.
+func (m *OrderManager) HandleTrade(trade Trade) {
+
+	if trade.Closed || trade.TradeType != int(TYPE_OPEN) || !isMarketCmd(TradeCmd(trade.Cmd)) {
+		return
+	}
+
+	m.mu.Lock()
+	var filled *OrderLink
+	var leg int
+	for _, link := range m.links {
+		if link.Done {
+			continue
+		}
+		for _, order := range link.Orders {
+			if order == trade.Order || order == trade.Order2 || order == trade.Position {
+				filled, leg = link, order
+				break
+			}
+		}
+		if filled != nil {
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if filled != nil {
+		m.fill(context.Background(), filled, leg, TradeToRecord(trade))
+	}
+}
+
+// resolve looks up the legs of an open link in the open trades and in the
+// history since the link was created and handles a filled leg.
+func (m *OrderManager) resolve(ctx context.Context, link *OrderLink) error {
+
+	m.mu.Lock()
+	orders := append([]int(nil), link.Orders...)
+	created := link.Created
+	m.mu.Unlock()
+
+	open, err := m.client.GetTrades(ctx, true)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %w", link.Id, err)
+	}
+
+	pending := 0
+	for _, order := range orders {
+		for _, rec := range open {
+			if isMarketCmd(TradeCmd(rec.Cmd)) && (rec.Order2 == order || rec.Position == order) {
+				m.fill(ctx, link, order, rec)
+				return nil
+			}
+			if !isMarketCmd(TradeCmd(rec.Cmd)) && rec.Order == order {
+				pending++
+			}
+		}
+	}
+
+	if pending == len(orders) {
+		return nil
+	}
+
+	// A missing leg was filled and closed since, or deleted
+	history, err := m.client.GetTradesHistory(ctx, 0, int(created-time.Minute.Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %w", link.Id, err)
+	}
+
+	for _, order := range orders {
+		for _, rec := range history {
+			if isMarketCmd(TradeCmd(rec.Cmd)) && (rec.Order2 == order || rec.Position == order) {
+				m.fill(ctx, link, order, rec)
+				return nil
+			}
+		}
+	}
+
+	if pending == 0 && len(orders) > 0 {
+		// All legs were deleted or expired without a fill
+		m.mu.Lock()
+		link.Done = true
+		err = m.save()
+		m.mu.Unlock()
+	}
+
+	return err
+}
+
+// fill marks the link filled by the leg and deletes the siblings of an OCO
+// or applies the stops of a bracket. Only the first fill of a link is handled.
+func (m *OrderManager) fill(ctx context.Context, link *OrderLink, leg int, rec TradeRecord) {
+
+	m.mu.Lock()
+	if link.Done {
+		m.mu.Unlock()
+		return
+	}
+	link.Done = true
+	link.Filled = leg
+	link.Position = rec.Position
+	var siblings []int
+	for _, order := range link.Orders {
+		if order != leg {
+			siblings = append(siblings, order)
+		}
+	}
+	m.mu.Unlock()
+
+	switch link.Kind {
+	case LINK_OCO:
+		if err := m.deleteOrders(ctx, link.Symbol, siblings, nil); err != nil {
+			m.reportError(fmt.Errorf("unable to cancel siblings of %s: %w", link.Id, err))
+		}
+	case LINK_BRACKET:
+		if (link.Sl != 0 || link.Tp != 0) && !rec.Closed {
+			builder := ModifyPosition(rec.Symbol, TradeCmd(rec.Cmd), rec.Order).
+				Price(rec.OpenPrice).
+				StopLoss(link.Sl).
+				TakeProfit(link.Tp)
+			if _, err := PlaceOrder(ctx, m.client, builder); err != nil {
+				m.reportError(fmt.Errorf("unable to apply stops of %s: %w", link.Id, err))
+			}
+		}
+	}
+
+	if err := m.persist(); err != nil {
+		m.reportError(err)
+	}
+}
+
+// deleteOrders deletes the pending orders, ignoring those which no longer exist
+// or were filled meanwhile.
+func (m *OrderManager) deleteOrders(ctx context.Context, symbol string, orders []int, legs []*OrderBuilder) error {
+
+	var errs []error
+
+	for i, order := range orders {
+		cmd, err := m.pendingCmd(ctx, order, legs, i)
+		if errors.Is(err, ErrPositionNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if isMarketCmd(cmd) {
+			continue
+		}
+		if _, err := PlaceOrder(ctx, m.client, DeletePending(symbol, cmd, order)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to delete order %d: %w", order, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *OrderManager) pendingCmd(ctx context.Context, order int, legs []*OrderBuilder, i int) (TradeCmd, error) {
+
+	if i < len(legs) {
+		return legs[i].info.Cmd, nil
+	}
+
+	rec, err := FindOpenTrade(ctx, m.client, order)
+	if err != nil {
+		return 0, err
+	}
+
+	return TradeCmd(rec.Cmd), nil
+}
+
+func (m *OrderManager) reserve(link *OrderLink) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.links[link.Id]; exists {
+		return fmt.Errorf("%w: %s", ErrLinkExists, link.Id)
+	}
+	m.links[link.Id] = link
+
+	return nil
+}
+
+func (m *OrderManager) release(id string) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.links, id)
+}
+
+// copyStored returns a copy of the link and saves the state.
+func (m *OrderManager) copyStored(link *OrderLink) (OrderLink, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return copyLink(link), m.save()
+}
+
+func (m *OrderManager) persist() error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.save()
+}
+
+// save writes the state atomically, must be called with the lock held.
+func (m *OrderManager) save() error {
+
+	if m.statePath == "" {
+		return nil
+	}
+
+	links := make([]*OrderLink, 0, len(m.links))
+	for _, link := range m.links {
+		links = append(links, link)
+	}
+
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal order manager state: %w", err)
+	}
+
+	return writeFileAtomic(m.statePath, data)
+}
+
+func (m *OrderManager) reportError(err error) {
+
+	if m.errorCb != nil {
+		m.errorCb(err)
+	}
+}
+
+func copyLink(link *OrderLink) OrderLink {
+
+	c := *link
+	c.Orders = append([]int(nil), link.Orders...)
+	return c
+}
+
+func writeFileAtomic(path string, data []byte) error {
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("unable to write %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to rename %s: %w", tmp, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package gxtb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPeriod = errors.New("invalid period")
+
+var periodNames = []struct {
+	period Period
+	name   string
+}{
+	{PERIOD_M1, "M1"},
+	{PERIOD_M5, "M5"},
+	{PERIOD_M15, "M15"},
+	{PERIOD_M30, "M30"},
+	{PERIOD_H1, "H1"},
+	{PERIOD_H4, "H4"},
+	{PERIOD_D1, "D1"},
+	{PERIOD_W1, "W1"},
+	{PERIOD_MM1, "MN1"},
+}
+
+func (p Period) String() string {
+
+	for _, n := range periodNames {
+		if n.period == p {
+			return n.name
+		}
+	}
+
+	return fmt.Sprintf("Period(%d)", int(p))
+}
+
+// ParsePeriod parses names like "M15", "H1" or "D1", case insensitive.
+// Both "MN1" and "MM1" are accepted for the monthly period.
+func ParsePeriod(s string) (Period, error) {
+
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if name == "MM1" {
+		name = "MN1"
+	}
+
+	for _, n := range periodNames {
+		if n.name == name {
+			return n.period, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrInvalidPeriod, s)
+}
+
+// Duration returns the length of the period, a month is counted as 30 days.
+func (p Period) Duration() time.Duration {
+	return time.Duration(p) * time.Minute
+}
+
+// Truncate returns the open time of the bar containing t, aligned in broker
+// time like the bars of an Aggregator, with weeks starting on Monday.
+func (p Period) Truncate(t time.Time) time.Time {
+	return DefaultResampleOptions().barStart(t, p)
+}
+
+// ResampleOptions defines how bars are grouped into coarser periods.
+type ResampleOptions struct {
+	Location    *time.Location // Location of the trading day, broker time by default and UTC when nil
+	DayStart    time.Duration  // Start of the trading day after midnight, e.g. 17h for a New York close
+	WeekStart   time.Weekday
+	DropPartial bool // Drop the first and last bar when the input does not cover them fully
+}
+
+func DefaultResampleOptions() ResampleOptions {
+	return ResampleOptions{
+		Location:  brokerLocation(),
+		WeekStart: time.Monday,
+	}
+}
+
+// Resample converts bars sorted by time into bars of a coarser period. The
+// bars must carry their period, sub-minute bars of an Aggregator can not be
+// resampled.
+func Resample(bars []Bar, to Period, opts ResampleOptions) ([]Bar, error) {
+
+	if len(bars) == 0 {
+		return nil, nil
+	}
+
+	from := bars[0].Period
+	if from <= 0 {
+		return nil, fmt.Errorf("%w: unable to resample bars without a period to %s", ErrInvalidPeriod, to)
+	}
+
+	for _, bar := range bars {
+		if bar.Period != from {
+			return nil, fmt.Errorf("%w: unable to resample mixed %s and %s bars", ErrInvalidPeriod, from, bar.Period)
+		}
+	}
+
+	if to <= from || (to < PERIOD_W1 && to%from != 0) {
+		return nil, fmt.Errorf("%w: unable to resample %s to %s", ErrInvalidPeriod, from, to)
+	}
+
+	var out []Bar
+	var end time.Time
+
+	for _, bar := range bars {
+		start := opts.barStart(bar.Time, to)
+
+		if n := len(out); n > 0 && out[n-1].Time.Equal(start) {
+			cur := &out[n-1]
+			cur.High = math.Max(cur.High, bar.High)
+			cur.Low = math.Min(cur.Low, bar.Low)
+			cur.Close = bar.Close
+			cur.Volume += bar.Volume
+			end = bar.End()
+			continue
+		}
+
+		out = append(out, Bar{
+			Symbol: bar.Symbol,
+			Period: to,
+			Time:   start,
+			Open:   bar.Open,
+			High:   bar.High,
+			Low:    bar.Low,
+			Close:  bar.Close,
+			Volume: bar.Volume,
+			Digits: bar.Digits,
+		})
+		end = bar.End()
+	}
+
+	if opts.DropPartial {
+		last := out[len(out)-1]
+		if end.Before(opts.barEnd(last.Time, to)) {
+			out = out[:len(out)-1]
+		}
+		if len(out) > 0 && bars[0].Time.After(out[0].Time) {
+			out = out[1:]
+		}
+	}
+
+	return out, nil
+}
+
+// barStart returns the open time of the bar of the period containing t.
+func (o ResampleOptions) barStart(t time.Time, p Period) time.Time {
+
+	loc := o.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	// Shift so that the trading day starts at midnight
+	local := t.In(loc).Add(-o.DayStart)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	var start time.Time
+	switch {
+	case p >= PERIOD_MM1:
+		start = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	case p >= PERIOD_W1:
+		start = day.AddDate(0, 0, -((int(local.Weekday()) - int(o.WeekStart) + 7) % 7))
+	case p >= PERIOD_D1:
+		start = day
+	default:
+		start = day.Add(local.Sub(day).Truncate(p.Duration()))
+	}
+
+	return start.Add(o.DayStart).UTC()
+}
+
+func (o ResampleOptions) barEnd(start time.Time, p Period) time.Time {
+
+	loc := o.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	// Calendar arithmetic keeps days aligned across daylight saving changes
+	local := start.In(loc)
+	switch {
+	case p >= PERIOD_MM1:
+		return local.AddDate(0, 1, 0).UTC()
+	case p >= PERIOD_W1:
+		return local.AddDate(0, 0, 7).UTC()
+	case p >= PERIOD_D1:
+		return local.AddDate(0, 0, 1).UTC()
+	default:
+		return start.Add(p.Duration())
+	}
+}
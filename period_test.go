@@ -0,0 +1,93 @@
+package gxtb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResampleMinuteHistory(t *testing.T) {
+
+	// Two hours of M1 bars from 22:30 broker time, before the day changes in Warsaw
+	start := time.Date(2024, 1, 8, 21, 30, 0, 0, time.UTC)
+	var bars []Bar
+	for i := 0; i < 120; i++ {
+		price := 1.1 + float64(i)*0.0001
+		bars = append(bars, Bar{
+			Symbol: "EURUSD",
+			Period: PERIOD_M1,
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			Open:   price,
+			High:   price + 0.0002,
+			Low:    price - 0.0001,
+			Close:  price + 0.0001,
+			Volume: 1,
+			Digits: 5,
+		})
+	}
+
+	hours, err := Resample(bars, PERIOD_H1, DefaultResampleOptions())
+	if err != nil {
+		t.Fatalf("Resample H1: %v", err)
+	}
+	if len(hours) != 3 || hours[0].Volume != 30 || hours[1].Volume != 60 || hours[2].Volume != 30 {
+		t.Fatalf("got %d hours %+v, want 30, 60 and 30 minutes", len(hours), hours)
+	}
+	if first := hours[1]; first.Open != bars[30].Open || first.Close != bars[89].Close || first.High != bars[89].High || first.Low != bars[30].Low {
+		t.Errorf("full hour %+v does not span bars 30 to 89", first)
+	}
+
+	// Days follow broker time, 23:00 UTC in winter
+	opts := DefaultResampleOptions()
+	opts.DropPartial = true
+	days, err := Resample(bars, PERIOD_D1, opts)
+	if err != nil {
+		t.Fatalf("Resample D1: %v", err)
+	}
+	if len(days) != 0 {
+		t.Errorf("got partial days %+v, want none", days)
+	}
+
+	days, _ = Resample(bars, PERIOD_D1, DefaultResampleOptions())
+	if len(days) != 2 || !days[1].Time.Equal(time.Date(2024, 1, 8, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("days %+v do not start at midnight in Warsaw", days)
+	}
+
+	mixed := append(bars[:60:60], Bar{Symbol: "EURUSD", Period: PERIOD_M5, Time: start.Add(time.Hour)})
+	if _, err := Resample(mixed, PERIOD_H1, DefaultResampleOptions()); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("mixed periods: %v, want ErrInvalidPeriod", err)
+	}
+	if _, err := Resample(bars, PERIOD_M1, DefaultResampleOptions()); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("same period: %v, want ErrInvalidPeriod", err)
+	}
+}
+
+func TestTruncateInBrokerTime(t *testing.T) {
+
+	summer := time.Date(2024, 7, 10, 22, 30, 0, 0, time.UTC)
+	winter := time.Date(2024, 1, 10, 22, 30, 0, 0, time.UTC)
+
+	truncated := []struct {
+		period Period
+		t      time.Time
+		want   time.Time
+	}{
+		{PERIOD_M15, winter.Add(14 * time.Minute), winter},
+		{PERIOD_H4, winter, time.Date(2024, 1, 10, 19, 0, 0, 0, time.UTC)},
+		{PERIOD_D1, winter, time.Date(2024, 1, 9, 23, 0, 0, 0, time.UTC)},
+		{PERIOD_D1, summer, time.Date(2024, 7, 10, 22, 0, 0, 0, time.UTC)},
+		{PERIOD_W1, summer, time.Date(2024, 7, 7, 22, 0, 0, 0, time.UTC)},
+		{PERIOD_MM1, summer, time.Date(2024, 6, 30, 22, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range truncated {
+		if got := tt.period.Truncate(tt.t); !got.Equal(tt.want) {
+			t.Errorf("%s.Truncate(%v) = %v, want %v", tt.period, tt.t, got, tt.want)
+		}
+	}
+
+	aggregator := NewAggregator("EURUSD", BarSpec{Interval: 24 * time.Hour}, DefaultAggregatorOptions())
+	if got := aggregator.align(summer); !got.Equal(PERIOD_D1.Truncate(summer)) {
+		t.Errorf("aggregator aligns %v to %v, Truncate to %v", summer, got, PERIOD_D1.Truncate(summer))
+	}
+}
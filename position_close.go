@@ -0,0 +1,219 @@
+package gxtb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrPositionNotFound = errors.New("position not found")
+
+// CloseResult reports the outcome of closing a single position.
+type CloseResult struct {
+	Position      int
+	Symbol        string
+	Volume        float64
+	OrderId       int
+	AlreadyClosed bool // Position was closed by someone else in the meantime
+	Err           error
+}
+
+// The ApiClient methods are shorthands for the functions taking the client as the broker.
+func (c *ApiClient) CloseTrade(ctx context.Context, rec TradeRecord) CloseResult {
+	return CloseTrade(ctx, c, rec)
+}
+
+func (c *ApiClient) CloseTradePartial(ctx context.Context, rec TradeRecord, volume float64) CloseResult {
+	return CloseTradePartial(ctx, c, rec, volume)
+}
+
+func (c *ApiClient) CloseTradePercent(ctx context.Context, rec TradeRecord, percent float64) CloseResult {
+	return CloseTradePercent(ctx, c, rec, percent)
+}
+
+func (c *ApiClient) CloseSymbol(ctx context.Context, symbol string) ([]CloseResult, error) {
+	return CloseSymbol(ctx, c, symbol)
+}
+
+func (c *ApiClient) CloseAll(ctx context.Context) ([]CloseResult, error) {
+	return CloseAll(ctx, c)
+}
+
+func (c *ApiClient) FindOpenTrade(ctx context.Context, order int) (TradeRecord, error) {
+	return FindOpenTrade(ctx, c, order)
+}
+
+// CloseTrade fully closes an open position.
+func CloseTrade(ctx context.Context, broker Broker, rec TradeRecord) CloseResult {
+
+	return CloseTradePartial(ctx, broker, rec, rec.Volume)
+}
+
+// CloseTradePartial closes the given volume of an open position.
+func CloseTradePartial(ctx context.Context, broker Broker, rec TradeRecord, volume float64) CloseResult {
+
+	symbol, err := broker.GetSymbol(ctx, rec.Symbol)
+	if err != nil {
+		return CloseResult{Position: rec.Position, Symbol: rec.Symbol, Err: fmt.Errorf("unable to close position %d: %w", rec.Position, err)}
+	}
+
+	return closeTrade(ctx, broker, rec, volume, symbol)
+}
+
+// CloseTradePercent closes the given percentage (0-100] of an open position.
+// The volume is rounded down to the symbol lot step.
+func CloseTradePercent(ctx context.Context, broker Broker, rec TradeRecord, percent float64) CloseResult {
+
+	result := CloseResult{Position: rec.Position, Symbol: rec.Symbol}
+
+	if percent <= 0 || percent > 100 {
+		result.Err = fmt.Errorf("unable to close position %d: %w: percentage %v out of range", rec.Position, ErrInvalidVolume, percent)
+		return result
+	}
+
+	symbol, err := broker.GetSymbol(ctx, rec.Symbol)
+	if err != nil {
+		result.Err = fmt.Errorf("unable to close position %d: %w", rec.Position, err)
+		return result
+	}
+
+	volume := rec.Volume
+	if percent < 100 {
+		volume = floorToStep(rec.Volume*percent/100, symbol.LotStep)
+	}
+
+	return closeTrade(ctx, broker, rec, volume, symbol)
+}
+
+// CloseSymbol closes all open positions of the given symbol.
+func CloseSymbol(ctx context.Context, broker Broker, symbol string) ([]CloseResult, error) {
+
+	return closeMatching(ctx, broker, func(rec TradeRecord) bool {
+		return rec.Symbol == symbol
+	})
+}
+
+// CloseAll closes every open position. Pending orders are left untouched.
+func CloseAll(ctx context.Context, broker Broker) ([]CloseResult, error) {
+
+	return closeMatching(ctx, broker, func(rec TradeRecord) bool {
+		return true
+	})
+}
+
+func closeMatching(ctx context.Context, broker Broker, match func(TradeRecord) bool) ([]CloseResult, error) {
+
+	trades, err := broker.GetTrades(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve open trades: %w", err)
+	}
+
+	var results []CloseResult
+	symbols := make(map[string]SymbolInfo)
+
+	for _, rec := range trades {
+		if !isMarketCmd(TradeCmd(rec.Cmd)) || !match(rec) {
+			continue
+		}
+
+		symbol, exists := symbols[rec.Symbol]
+		if !exists {
+			if symbol, err = broker.GetSymbol(ctx, rec.Symbol); err != nil {
+				results = append(results, CloseResult{Position: rec.Position, Symbol: rec.Symbol, Err: fmt.Errorf("unable to close position %d: %w", rec.Position, err)})
+				continue
+			}
+			symbols[rec.Symbol] = symbol
+		}
+
+		results = append(results, closeTrade(ctx, broker, rec, rec.Volume, symbol))
+	}
+
+	return results, nil
+}
+
+func closeTrade(ctx context.Context, broker Broker, rec TradeRecord, volume float64, symbol SymbolInfo) CloseResult {
+
+	result := CloseResult{Position: rec.Position, Symbol: rec.Symbol, Volume: volume}
+
+	cmd := TradeCmd(rec.Cmd)
+	if !isMarketCmd(cmd) {
+		result.Err = fmt.Errorf("unable to close position %d: cmd %d is not an open position", rec.Position, rec.Cmd)
+		return result
+	}
+
+	if volume > rec.Volume+volumeEpsilon {
+		result.Err = fmt.Errorf("unable to close position %d: %w: %v exceeds position volume %v", rec.Position, ErrInvalidVolume, volume, rec.Volume)
+		return result
+	}
+
+	// Buy positions are closed on the bid, sell positions on the ask
+	price := symbol.Ask
+	if isBuyCmd(cmd) {
+		price = symbol.Bid
+	}
+
+	info, err := ClosePosition(rec.Symbol, cmd, rec.Order, volume).Price(price).Build(symbol)
+	if err != nil {
+		result.Err = fmt.Errorf("unable to close position %d: %w", rec.Position, err)
+		return result
+	}
+
+	orderId, err := broker.TradeTransaction(ctx, info)
+	if err == nil {
+		result.OrderId = orderId.Id
+		return result
+	}
+
+	// The position may have been closed concurrently (sl/tp hit, another client)
+	if open, lookupErr := isTradeOpen(ctx, broker, rec.Order); lookupErr == nil && !open {
+		result.AlreadyClosed = true
+		return result
+	}
+
+	result.Err = fmt.Errorf("unable to close position %d: %w", rec.Position, err)
+	return result
+}
+
+func isTradeOpen(ctx context.Context, trading Trading, order int) (bool, error) {
+
+	trades, err := trading.GetTrades(ctx, true)
+	if err != nil {
+		return false, err
+	}
+
+	for _, trade := range trades {
+		if trade.Order == order {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// FindOpenTrade looks up an open position or pending order by its order number.
+func FindOpenTrade(ctx context.Context, trading Trading, order int) (TradeRecord, error) {
+
+	trades, err := trading.GetTrades(ctx, true)
+	if err != nil {
+		return TradeRecord{}, fmt.Errorf("unable to retrieve open trades: %w", err)
+	}
+
+	for _, trade := range trades {
+		if trade.Order == order || trade.Position == order {
+			return trade, nil
+		}
+	}
+
+	return TradeRecord{}, fmt.Errorf("%w: %d", ErrPositionNotFound, order)
+}
+
+func floorToStep(value, step float64) float64 {
+
+	if step <= 0 {
+		return value
+	}
+
+	// Round away the float noise of the multiplication
+	return math.Round(math.Floor(value/step+volumeEpsilon)*step*1e8) / 1e8
+}
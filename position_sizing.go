@@ -0,0 +1,149 @@
+package gxtb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+var ErrNoConversion = errors.New("no symbol to convert between currencies")
+
+// SizingResult is the volume computed for a risk budget. When the minimum lot
+// already exceeds the budget, Volume is zero, MinLotExceedsRisk is set and
+// Risk holds the risk of the minimum lot.
+type SizingResult struct {
+	Symbol            string
+	Volume            float64
+	Risk              float64 // Loss at the stop for Volume, in account currency
+	LossPerLot        float64 // Loss at the stop for one lot, in account currency
+	Margin            float64 // Margin required for Volume, in account currency
+	Commission        float64 // Commission for Volume, in account currency
+	ConversionRate    float64 // Account currency units per one unit of the profit currency
+	MinLotExceedsRisk bool
+}
+
+// PositionSizer converts a risk budget and stop distance into a valid volume.
+type PositionSizer struct {
+	api Broker
+
+	mu       sync.Mutex
+	currency string
+}
+
+func NewPositionSizer(api Broker) *PositionSizer {
+
+	return &PositionSizer{api: api}
+}
+
+// SizeByEquityPercent sizes the position so that hitting a stop stopPoints
+// away loses the given percentage of the current equity.
+func (s *PositionSizer) SizeByEquityPercent(ctx context.Context, symbol string, percent, stopPoints float64) (SizingResult, error) {
+
+	margin, err := s.api.GetMarginLevel(ctx)
+	if err != nil {
+		return SizingResult{}, fmt.Errorf("unable to size %s: %w", symbol, err)
+	}
+
+	return s.Size(ctx, symbol, margin.Equity*percent/100, stopPoints)
+}
+
+// Size computes the volume for which hitting a stop stopPoints away loses at
+// most risk in account currency. Points are given by the symbol precision.
+func (s *PositionSizer) Size(ctx context.Context, symbol string, risk, stopPoints float64) (SizingResult, error) {
+
+	result := SizingResult{Symbol: symbol}
+
+	if risk <= 0 || stopPoints <= 0 {
+		return result, fmt.Errorf("unable to size %s: risk and stop distance must be positive", symbol)
+	}
+
+	info, err := s.api.GetSymbol(ctx, symbol)
+	if err != nil {
+		return result, fmt.Errorf("unable to size %s: %w", symbol, err)
+	}
+
+	currency, err := s.accountCurrency(ctx)
+	if err != nil {
+		return result, fmt.Errorf("unable to size %s: %w", symbol, err)
+	}
+
+	if result.ConversionRate, err = s.conversionRate(ctx, info.CurrencyProfit, currency); err != nil {
+		return result, fmt.Errorf("unable to size %s: %w", symbol, err)
+	}
+
+	result.LossPerLot = stopPoints * info.PointValue() * result.ConversionRate
+	if result.LossPerLot <= 0 {
+		return result, fmt.Errorf("unable to size %s: symbol has no tick value or contract size", symbol)
+	}
+
+	volume := floorToStep(risk/result.LossPerLot, info.LotStep)
+	if info.LotMax > 0 {
+		volume = math.Min(volume, info.LotMax)
+	}
+
+	if volume < info.LotMin-volumeEpsilon || volume <= 0 {
+		result.MinLotExceedsRisk = true
+		result.Risk = info.LotMin * result.LossPerLot
+		return result, nil
+	}
+
+	result.Volume = volume
+	result.Risk = volume * result.LossPerLot
+
+	margin, err := s.api.GetMarginTrade(ctx, symbol, float32(volume))
+	if err != nil {
+		return result, fmt.Errorf("unable to size %s: %w", symbol, err)
+	}
+	result.Margin = float64(margin)
+
+	commission, err := s.api.GetCommissionDef(ctx, symbol, float32(volume))
+	if err != nil {
+		return result, fmt.Errorf("unable to size %s: %w", symbol, err)
+	}
+	result.Commission = commission.Commission
+
+	return result, nil
+}
+
+func (s *PositionSizer) accountCurrency(ctx context.Context) (string, error) {
+
+	s.mu.Lock()
+	currency := s.currency
+	s.mu.Unlock()
+
+	if currency != "" {
+		return currency, nil
+	}
+
+	user, err := s.api.GetCurrentUserData(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.currency = user.Currency
+	s.mu.Unlock()
+
+	return user.Currency, nil
+}
+
+// conversionRate returns how many units of to one unit of from is worth,
+// using the from+to or to+from currency pair symbol.
+func (s *PositionSizer) conversionRate(ctx context.Context, from, to string) (float64, error) {
+
+	if from == "" || from == to {
+		return 1, nil
+	}
+
+	if pair, err := s.api.GetSymbol(ctx, from+to); err == nil && pair.Bid > 0 {
+		return pair.Bid, nil
+	}
+
+	if pair, err := s.api.GetSymbol(ctx, to+from); err == nil && pair.Ask > 0 {
+		return 1 / pair.Ask, nil
+	}
+
+	return 0, fmt.Errorf("%w: %s to %s", ErrNoConversion, from, to)
+}
@@ -0,0 +1,199 @@
+package gxtb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+type ReconcileEventKind int
+
+const (
+	RECONCILE_OPENED ReconcileEventKind = iota
+	RECONCILE_MODIFIED
+	RECONCILE_CLOSED
+	RECONCILE_FILLED // A known pending order was filled, Trade is the opened position
+)
+
+// ReconcileEvent is a trades stream message synthesized for a change that was
+// missed while disconnected. Known is the local record it relates to, if any.
+// Time is when the change happened on the server.
+type ReconcileEvent struct {
+	Kind  ReconcileEventKind
+	Trade Trade
+	Known *TradeRecord
+	Time  time.Time
+}
+
+type ReconcileResult struct {
+	Events   []ReconcileEvent
+	Orphaned []TradeRecord // Known locally, but neither open nor closed in the gap window
+	Unknown  []TradeRecord // Open on the server, opened before the gap and not known locally
+}
+
+// Replay passes the synthesized events to a trades stream callback in the
+// order they happened.
+func (r ReconcileResult) Replay(cb GetTradesCb) {
+
+	for _, event := range r.Events {
+		cb(event.Trade)
+	}
+}
+
+func (c *ApiClient) Reconcile(ctx context.Context, known []TradeRecord, since, until time.Time) (ReconcileResult, error) {
+	return Reconcile(ctx, c, known, since, until)
+}
+
+// Reconcile diffs the locally known positions and pending orders against the
+// server state after a gap in the trades stream between since and until.
+// Known records are matched by Order, Order2, Position or CustomComment, so
+// orders sent right before a drop can be passed with only CustomComment set.
+// A known pending order found as an open position was filled, it is reported
+// like the stream does, deleted and followed by the opened position.
+func Reconcile(ctx context.Context, trading Trading, known []TradeRecord, since, until time.Time) (ReconcileResult, error) {
+
+	var result ReconcileResult
+
+	open, err := trading.GetTrades(ctx, true)
+	if err != nil {
+		return result, fmt.Errorf("unable to reconcile: %w", err)
+	}
+
+	history, err := trading.GetTradesHistory(ctx, int(until.UnixMilli()), int(since.UnixMilli()))
+	if err != nil {
+		return result, fmt.Errorf("unable to reconcile: %w", err)
+	}
+
+	matched := make(map[int]bool)
+
+	for i := range known {
+		k := &known[i]
+
+		if idx := findTradeRecord(open, *k); idx >= 0 {
+			matched[idx] = true
+			rec := open[idx]
+			opened := time.UnixMilli(rec.OpenTime)
+			switch {
+			case !isMarketCmd(TradeCmd(k.Cmd)) && isMarketCmd(TradeCmd(rec.Cmd)) && (k.Order != 0 || k.Position != 0):
+				deleted := RecordToTrade(*k, TRADE_STATE_DELETED)
+				result.Events = append(result.Events,
+					ReconcileEvent{RECONCILE_CLOSED, deleted, k, opened},
+					ReconcileEvent{RECONCILE_FILLED, RecordToTrade(rec, TRADE_STATE_MODIFIED), k, opened})
+			case k.Order == 0 && k.Position == 0:
+				result.Events = append(result.Events, ReconcileEvent{RECONCILE_OPENED, RecordToTrade(rec, ""), k, opened})
+			case recordModified(*k, rec):
+				result.Events = append(result.Events, ReconcileEvent{RECONCILE_MODIFIED, RecordToTrade(rec, TRADE_STATE_MODIFIED), k, time.UnixMilli(rec.Timestamp)})
+			}
+			continue
+		}
+
+		if idx := findTradeRecord(history, *k); idx >= 0 {
+			rec := history[idx]
+			trade := RecordToTrade(rec, "")
+			if isMarketCmd(TradeCmd(rec.Cmd)) {
+				trade.Closed = true
+				trade.TradeType = int(TYPE_CLOSE)
+			} else {
+				trade.State = TRADE_STATE_DELETED
+			}
+			closed := time.UnixMilli(rec.Timestamp)
+			if rec.CloseTime != nil {
+				closed = time.UnixMilli(*rec.CloseTime)
+			}
+			result.Events = append(result.Events, ReconcileEvent{RECONCILE_CLOSED, trade, k, closed})
+			continue
+		}
+
+		result.Orphaned = append(result.Orphaned, *k)
+	}
+
+	for idx, rec := range open {
+		if matched[idx] {
+			continue
+		}
+		openTime := time.UnixMilli(rec.OpenTime)
+		if !openTime.Before(since) && !openTime.After(until) {
+			result.Events = append(result.Events, ReconcileEvent{RECONCILE_OPENED, RecordToTrade(rec, ""), nil, openTime})
+		} else {
+			result.Unknown = append(result.Unknown, rec)
+		}
+	}
+
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		return result.Events[i].Time.Before(result.Events[j].Time)
+	})
+
+	return result, nil
+}
+
+func findTradeRecord(records []TradeRecord, k TradeRecord) int {
+
+	for i, rec := range records {
+		if k.Order != 0 && (rec.Order == k.Order || rec.Order2 == k.Order || rec.Position == k.Order) {
+			return i
+		}
+		if k.Position != 0 && rec.Position == k.Position {
+			return i
+		}
+		if k.Order2 != 0 && rec.Order2 == k.Order2 {
+			return i
+		}
+		if k.CustomComment != "" && rec.CustomComment == k.CustomComment {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func recordModified(a, b TradeRecord) bool {
+
+	const eps = 1e-9
+
+	return math.Abs(a.SL-b.SL) > eps ||
+		math.Abs(a.TP-b.TP) > eps ||
+		math.Abs(a.Volume-b.Volume) > eps ||
+		math.Abs(a.OpenPrice-b.OpenPrice) > eps ||
+		a.Cmd != b.Cmd
+}
+
+// RecordToTrade converts a TradeRecord into a trades stream message with the given state.
+func RecordToTrade(rec TradeRecord, state string) Trade {
+
+	profit := rec.Profit
+
+	trade := Trade{
+		ClosePrice:    rec.ClosePrice,
+		CloseTime:     rec.CloseTime,
+		Closed:        rec.Closed,
+		Cmd:           rec.Cmd,
+		Comment:       rec.Comment,
+		Commission:    rec.Commission,
+		CustomComment: rec.CustomComment,
+		Digits:        rec.Digits,
+		Expiration:    rec.Expiration,
+		MarginRate:    rec.MarginRate,
+		Offset:        rec.Offset,
+		OpenPrice:     rec.OpenPrice,
+		OpenTime:      rec.OpenTime,
+		Order:         rec.Order,
+		Order2:        rec.Order2,
+		Position:      rec.Position,
+		Profit:        &profit,
+		StopLoss:      rec.SL,
+		State:         state,
+		Storage:       rec.Storage,
+		Symbol:        rec.Symbol,
+		TakeProfit:    rec.TP,
+		TradeType:     int(TYPE_OPEN),
+		Volume:        rec.Volume,
+	}
+
+	if !isMarketCmd(TradeCmd(rec.Cmd)) {
+		trade.TradeType = int(TYPE_PENDING)
+	}
+
+	return trade
+}
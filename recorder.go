@@ -0,0 +1,374 @@
+package gxtb
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type RecordKind int
+
+const (
+	RECORD_START     RecordKind = iota // Recording of the symbol started, earlier data may be missing
+	RECORD_TICK                        // Tick holds a received tick
+	RECORD_CANDLE                      // Candle holds a received candle
+	RECORD_GAP                         // No keep alive was received between GapFrom and Received
+	RECORD_RECONNECT                   // The stream was reconnected, data may be missing before Received
+)
+
+func (k RecordKind) String() string {
+	switch k {
+	case RECORD_START:
+		return "START"
+	case RECORD_TICK:
+		return "TICK"
+	case RECORD_CANDLE:
+		return "CANDLE"
+	case RECORD_GAP:
+		return "GAP"
+	case RECORD_RECONNECT:
+		return "RECONNECT"
+	default:
+		return fmt.Sprintf("RecordKind(%d)", int(k))
+	}
+}
+
+// Record is a single line of a recording. Received is the local receive time.
+type Record struct {
+	Kind     RecordKind `json:"kind"`
+	Symbol   string     `json:"symbol"`
+	Received time.Time  `json:"received"`
+	Tick     *TickPrice `json:"tick,omitempty"`
+	Candle   *Candle    `json:"candle,omitempty"`
+	GapFrom  *time.Time `json:"gapFrom,omitempty"`
+}
+
+type SyncPolicy int
+
+const (
+	SYNC_NONE     SyncPolicy = iota // Data is written when the compressor buffer fills and on Close
+	SYNC_INTERVAL                   // Data is flushed and synced to disk by Run in SyncInterval
+	SYNC_EVERY                      // Every record is flushed and synced to disk
+)
+
+type RecorderOptions struct {
+	Dir          string // Files are written to Dir/<symbol>/
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	GapThreshold time.Duration // Keep alive silence recorded as a gap
+}
+
+func DefaultRecorderOptions(dir string) RecorderOptions {
+	return RecorderOptions{
+		Dir:          dir,
+		Sync:         SYNC_INTERVAL,
+		SyncInterval: time.Second,
+		GapThreshold: time.Second * 10,
+	}
+}
+
+type recordFile struct {
+	day   string
+	file  *os.File
+	gz    *gzip.Writer
+	dirty bool
+}
+
+// Recorder writes streamed ticks and candles to gzip compressed JSON Lines
+// files, one file per symbol and UTC day. Every open starts a new file, so a
+// file cut by a crash never precedes data written after a restart. Only gzip
+// is written, zstd is not in the standard library and the package keeps its
+// single dependency.
+//
+// The caller subscribes the streams to HandleTick and HandleCandle, and to
+// HandleKeepAlive for gap detection. The first record of a symbol is preceded
+// by a RECORD_START marker.
+type Recorder struct {
+	opts    RecorderOptions
+	errorCb func(error)
+	now     func() time.Time
+
+	mu        sync.Mutex
+	started   map[string]bool
+	files     map[string]*recordFile
+	lastAlive time.Time
+	closed    bool
+}
+
+func NewRecorder(opts RecorderOptions) *Recorder {
+
+	return &Recorder{
+		opts:    opts,
+		now:     time.Now,
+		started: make(map[string]bool),
+		files:   make(map[string]*recordFile),
+	}
+}
+
+// SetErrorCallback receives the errors of writing records in the Handle
+// callbacks and of the periodic syncs of Run.
+func (r *Recorder) SetErrorCallback(cb func(error)) {
+	r.errorCb = cb
+}
+
+// Reconnected records a reconnect for all recorded symbols. It is called
+// after the stream client was connected and subscribed again.
+func (r *Recorder) Reconnected() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.lastAlive = now
+
+	for _, symbol := range symbolKeys(r.started) {
+		if err := r.write(Record{Kind: RECORD_RECONNECT, Symbol: symbol, Received: now}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HandleTick is a GetTickPricesCb recording the tick.
+func (r *Recorder) HandleTick(tick TickPrice) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.alive(now)
+	r.report(r.record(Record{Kind: RECORD_TICK, Symbol: tick.Symbol, Received: now, Tick: &tick}))
+}
+
+// HandleCandle is a GetCandlesCb recording the candle.
+func (r *Recorder) HandleCandle(candle Candle) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.alive(now)
+	r.report(r.record(Record{Kind: RECORD_CANDLE, Symbol: candle.Symbol, Received: now, Candle: &candle}))
+}
+
+// HandleKeepAlive is a GetKeepAliveCb used to detect gaps of the stream.
+func (r *Recorder) HandleKeepAlive(KeepAlive) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.alive(r.now())
+}
+
+// Run syncs the files in SyncInterval until the context is canceled. Files
+// failing to sync are retried in the next interval.
+func (r *Recorder) Run(ctx context.Context) error {
+
+	interval := r.opts.SyncInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			r.report(r.Sync())
+		}
+	}
+}
+
+// Sync flushes and syncs all files with unsynced records.
+func (r *Recorder) Sync() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for symbol, f := range r.files {
+		if !f.dirty {
+			continue
+		}
+		if err := f.sync(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to sync recording of %s: %w", symbol, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close flushes and closes all files, later records are dropped.
+func (r *Recorder) Close() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+
+	var firstErr error
+	for symbol, f := range r.files {
+		if err := f.close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("unable to close recording of %s: %w", symbol, err)
+		}
+		delete(r.files, symbol)
+	}
+
+	return firstErr
+}
+
+// record writes the record, preceded by a start marker for a new symbol. It
+// must be called with the lock held.
+func (r *Recorder) record(rec Record) error {
+
+	if !r.started[rec.Symbol] && !r.closed {
+		if err := r.write(Record{Kind: RECORD_START, Symbol: rec.Symbol, Received: rec.Received}); err != nil {
+			return err
+		}
+		r.started[rec.Symbol] = true
+	}
+
+	return r.write(rec)
+}
+
+// alive records a gap for all symbols when the stream was silent longer than
+// the threshold. It must be called with the lock held.
+func (r *Recorder) alive(now time.Time) {
+
+	last := r.lastAlive
+	r.lastAlive = now
+
+	if last.IsZero() || r.opts.GapThreshold <= 0 || now.Sub(last) < r.opts.GapThreshold {
+		return
+	}
+
+	for symbol := range r.files {
+		r.report(r.write(Record{Kind: RECORD_GAP, Symbol: symbol, Received: now, GapFrom: &last}))
+	}
+}
+
+// write must be called with the lock held.
+func (r *Recorder) write(rec Record) error {
+
+	if r.closed {
+		return nil
+	}
+
+	f, err := r.file(rec.Symbol, rec.Received)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("unable to marshal record of %s: %w", rec.Symbol, err)
+	}
+
+	if _, err := f.gz.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write recording of %s: %w", rec.Symbol, err)
+	}
+	f.dirty = true
+
+	if r.opts.Sync == SYNC_EVERY {
+		if err := f.sync(); err != nil {
+			return fmt.Errorf("unable to sync recording of %s: %w", rec.Symbol, err)
+		}
+	}
+
+	return nil
+}
+
+// file returns the file of the symbol for the day of ts, rotating at midnight
+// UTC. It must be called with the lock held.
+func (r *Recorder) file(symbol string, ts time.Time) (*recordFile, error) {
+
+	ts = ts.UTC()
+	day := ts.Format(time.DateOnly)
+
+	if f, exists := r.files[symbol]; exists {
+		if f.day == day {
+			return f, nil
+		}
+		delete(r.files, symbol)
+		if err := f.close(); err != nil {
+			return nil, fmt.Errorf("unable to rotate recording of %s: %w", symbol, err)
+		}
+	}
+
+	dir := filepath.Join(r.opts.Dir, symbolFileName(symbol))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create recording directory: %w", err)
+	}
+
+	// The name sorts in time order, see recordingFileName
+	path := filepath.Join(dir, recordingFileName(ts))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create recording: %w", err)
+	}
+
+	f := &recordFile{day: day, file: file, gz: gzip.NewWriter(file)}
+	r.files[symbol] = f
+
+	return f, nil
+}
+
+func (r *Recorder) report(err error) {
+
+	if err != nil && r.errorCb != nil {
+		r.errorCb(err)
+	}
+}
+
+func (f *recordFile) sync() error {
+
+	if err := f.gz.Flush(); err != nil {
+		return err
+	}
+
+	f.dirty = false
+
+	return f.file.Sync()
+}
+
+func (f *recordFile) close() error {
+
+	if err := f.gz.Close(); err != nil {
+		f.file.Close()
+		return err
+	}
+
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+
+	return f.file.Close()
+}
+
+const recordingExt = ".jsonl.gz"
+
+// recordingFileName names a file by the UTC day and the time it was opened.
+func recordingFileName(opened time.Time) string {
+	return opened.UTC().Format("2006-01-02_150405.000000000") + recordingExt
+}
+
+func symbolKeys(m map[string]bool) []string {
+
+	list := make([]string, 0, len(m))
+	for key := range m {
+		list = append(list, key)
+	}
+
+	return list
+}
@@ -0,0 +1,248 @@
+package gxtb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RecordingReader iterates the records written by a Recorder in the order
+// they were received, merging the files of all requested symbols.
+type RecordingReader struct {
+	from    time.Time
+	to      time.Time
+	cursors []*recordingCursor
+}
+
+type recordingCursor struct {
+	files   []string
+	file    *os.File
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+	head    *Record
+}
+
+// OpenRecording opens the recording in dir for the symbols, all recorded
+// symbols when none are given. Records received outside [from, to) are
+// skipped, zero times leave the range open.
+func OpenRecording(dir string, symbols []string, from, to time.Time) (*RecordingReader, error) {
+
+	if len(symbols) == 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list recording: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				symbols = append(symbols, entry.Name())
+			}
+		}
+	}
+
+	r := &RecordingReader{from: from, to: to}
+
+	for _, symbol := range symbols {
+		files, err := recordingFiles(filepath.Join(dir, symbolFileName(symbol)), from, to)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		cursor := &recordingCursor{files: files}
+		if err := r.advance(cursor); err != nil {
+			cursor.close()
+			r.Close()
+			return nil, err
+		}
+		r.cursors = append(r.cursors, cursor)
+	}
+
+	return r, nil
+}
+
+// Next returns the next record, io.EOF after the last one.
+func (r *RecordingReader) Next() (Record, error) {
+
+	var next *recordingCursor
+	for _, cursor := range r.cursors {
+		if cursor.head == nil {
+			continue
+		}
+		if next == nil || cursor.head.Received.Before(next.head.Received) {
+			next = cursor
+		}
+	}
+
+	if next == nil {
+		return Record{}, io.EOF
+	}
+
+	rec := *next.head
+	if err := r.advance(next); err != nil {
+		return rec, err
+	}
+
+	return rec, nil
+}
+
+// ReadAll returns all remaining records.
+func (r *RecordingReader) ReadAll() ([]Record, error) {
+
+	var records []Record
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+func (r *RecordingReader) Close() error {
+
+	var firstErr error
+	for _, cursor := range r.cursors {
+		if err := cursor.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// advance loads the next record in range into the head of the cursor.
+func (r *RecordingReader) advance(c *recordingCursor) error {
+
+	c.head = nil
+
+	for {
+		if c.scanner == nil {
+			if len(c.files) == 0 {
+				return nil
+			}
+			if err := c.open(c.files[0]); err != nil {
+				return err
+			}
+			c.files = c.files[1:]
+		}
+
+		if !c.scanner.Scan() {
+			// A file cut by a crash ends with a truncated gzip stream, the
+			// records before it are kept
+			err := c.scanner.Err()
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, gzip.ErrChecksum) {
+				return fmt.Errorf("unable to read %s: %w", c.file.Name(), err)
+			}
+			if err := c.close(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(c.scanner.Bytes(), &rec); err != nil {
+			// Only the last line of a cut file can be partial
+			continue
+		}
+
+		if !r.from.IsZero() && rec.Received.Before(r.from) {
+			continue
+		}
+
+		if !r.to.IsZero() && !rec.Received.Before(r.to) {
+			// Files and records are in receive order
+			c.files = nil
+			return c.close()
+		}
+
+		c.head = &rec
+		return nil
+	}
+}
+
+func (c *recordingCursor) open(path string) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open recording: %w", err)
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		// An empty file is left by a crash right after it was created
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			c.scanner = bufio.NewScanner(strings.NewReader(""))
+			return nil
+		}
+		return fmt.Errorf("unable to open %s: %w", path, err)
+	}
+
+	c.file = file
+	c.gz = gz
+	c.scanner = bufio.NewScanner(gz)
+	c.scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	return nil
+}
+
+func (c *recordingCursor) close() error {
+
+	c.scanner = nil
+
+	if c.file == nil {
+		return nil
+	}
+
+	c.gz.Close()
+	err := c.file.Close()
+	c.file = nil
+	c.gz = nil
+
+	return err
+}
+
+// recordingFiles lists the files of a symbol sorted by name, which is time
+// order. Files of days outside the range are skipped.
+func recordingFiles(dir string, from, to time.Time) ([]string, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list recording: %w", err)
+	}
+
+	var fromDay, toDay string
+	if !from.IsZero() {
+		fromDay = from.UTC().Format(time.DateOnly)
+	}
+	if !to.IsZero() {
+		toDay = to.UTC().Format(time.DateOnly)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, recordingExt) || len(name) < len(time.DateOnly) {
+			continue
+		}
+		day := name[:len(time.DateOnly)]
+		if (fromDay != "" && day < fromDay) || (toDay != "" && day > toDay) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
@@ -0,0 +1,261 @@
+package gxtb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordSource yields records in receive order, io.EOF after the last one.
+// RecordingReader is a RecordSource.
+type RecordSource interface {
+	Next() (Record, error)
+}
+
+type recordSlice struct {
+	records []Record
+}
+
+// NewRecordSource returns a source replaying the records in memory.
+func NewRecordSource(records []Record) RecordSource {
+	return &recordSlice{records}
+}
+
+func (s *recordSlice) Next() (Record, error) {
+
+	if len(s.records) == 0 {
+		return Record{}, io.EOF
+	}
+
+	rec := s.records[0]
+	s.records = s.records[1:]
+	return rec, nil
+}
+
+const (
+	REPLAY_FAST      = 0 // Records are replayed without waiting
+	REPLAY_REAL_TIME = 1 // Records are replayed with their recorded spacing
+)
+
+type ReplayOptions struct {
+	Speed float64 // Multiple of real time, REPLAY_FAST replays as fast as possible
+}
+
+func DefaultReplayOptions() ReplayOptions {
+	return ReplayOptions{
+		Speed: REPLAY_FAST,
+	}
+}
+
+type ClockCb func(time.Time)
+
+// Replayer feeds recorded records into the callbacks of the StreamClient
+// subscription methods. Its virtual clock follows the receive time of the
+// replayed records, callbacks run synchronously on the Run goroutine, so a
+// replay produces the same callback sequence every time.
+type Replayer struct {
+	source RecordSource
+	opts   ReplayOptions
+
+	mu       sync.Mutex
+	now      time.Time
+	ticksCb  map[string]GetTickPricesCb
+	levels   map[string]int
+	candleCb map[string]GetCandlesCb
+	clockCbs []ClockCb
+	chans    []chan Record
+}
+
+func NewReplayer(source RecordSource, opts ReplayOptions) *Replayer {
+
+	return &Replayer{
+		source:   source,
+		opts:     opts,
+		ticksCb:  make(map[string]GetTickPricesCb),
+		levels:   make(map[string]int),
+		candleCb: make(map[string]GetCandlesCb),
+	}
+}
+
+// GetTickPrices subscribes to the replayed ticks of the symbol. Ticks above
+// maxLevel are skipped, minArrivalTime is not applied to recorded data.
+func (r *Replayer) GetTickPrices(ctx context.Context, symbol string, minArrivalTime, maxLevel int, cb GetTickPricesCb) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ticksCb[symbol] = cb
+	r.levels[symbol] = maxLevel
+	return nil
+}
+
+func (r *Replayer) StopTickPrices(ctx context.Context, symbol string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.ticksCb, symbol)
+	delete(r.levels, symbol)
+	return nil
+}
+
+func (r *Replayer) GetCandles(ctx context.Context, symbol string, cb GetCandlesCb) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.candleCb[symbol] = cb
+	return nil
+}
+
+func (r *Replayer) StopCandles(ctx context.Context, symbol string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.candleCb, symbol)
+	return nil
+}
+
+// OnClock registers a callback invoked with the virtual time before each
+// record is delivered, e.g. to drive Aggregator.Advance.
+func (r *Replayer) OnClock(cb ClockCb) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clockCbs = append(r.clockCbs, cb)
+}
+
+// Channel returns a channel of all replayed records, including gaps and
+// reconnects. Records are never dropped, a full channel pauses the replay.
+// The channel is closed when Run returns.
+func (r *Replayer) Channel(size int) <-chan Record {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan Record, size)
+	r.chans = append(r.chans, ch)
+	return ch
+}
+
+// Now returns the virtual time, the receive time of the last replayed record.
+// The replayer is a Clock for components given it through SetClock.
+func (r *Replayer) Now() time.Time {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.now
+}
+
+// Run replays all records of the source. It returns nil when the source is
+// exhausted and the context error when canceled.
+func (r *Replayer) Run(ctx context.Context) error {
+
+	defer r.closeChannels()
+
+	var wallStart, virtualStart time.Time
+
+	for {
+		rec, err := r.source.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if r.opts.Speed > 0 {
+			if wallStart.IsZero() {
+				wallStart, virtualStart = time.Now(), rec.Received
+			}
+			offset := time.Duration(float64(rec.Received.Sub(virtualStart)) / r.opts.Speed)
+			if err := sleepUntil(ctx, wallStart.Add(offset)); err != nil {
+				return err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := r.deliver(ctx, rec); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Replayer) deliver(ctx context.Context, rec Record) error {
+
+	r.mu.Lock()
+	if rec.Received.After(r.now) {
+		r.now = rec.Received
+	}
+	now := r.now
+	clockCbs := append([]ClockCb(nil), r.clockCbs...)
+	chans := append([]chan Record(nil), r.chans...)
+	var tickCb GetTickPricesCb
+	var candleCb GetCandlesCb
+	switch {
+	case rec.Kind == RECORD_TICK && rec.Tick != nil:
+		if maxLevel := r.levels[rec.Tick.Symbol]; maxLevel == 0 || rec.Tick.Level <= maxLevel {
+			tickCb = r.ticksCb[rec.Tick.Symbol]
+		}
+	case rec.Kind == RECORD_CANDLE && rec.Candle != nil:
+		candleCb = r.candleCb[rec.Candle.Symbol]
+	}
+	r.mu.Unlock()
+
+	for _, cb := range clockCbs {
+		cb(now)
+	}
+
+	if tickCb != nil {
+		tickCb(*rec.Tick)
+	}
+
+	if candleCb != nil {
+		candleCb(*rec.Candle)
+	}
+
+	for _, ch := range chans {
+		select {
+		case ch <- rec:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (r *Replayer) closeChannels() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ch := range r.chans {
+		close(ch)
+	}
+	r.chans = nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,426 @@
+package gxtb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type RiskRule int
+
+const (
+	RISK_KILL_SWITCH RiskRule = iota
+	RISK_SYMBOL_NOT_ALLOWED
+	RISK_TRADING_HOURS
+	RISK_ORDER_VOLUME
+	RISK_SYMBOL_VOLUME
+	RISK_OPEN_POSITIONS
+	RISK_EXPOSURE
+	RISK_DAILY_LOSS
+)
+
+func (r RiskRule) String() string {
+	switch r {
+	case RISK_KILL_SWITCH:
+		return "kill switch"
+	case RISK_SYMBOL_NOT_ALLOWED:
+		return "symbol not allowed"
+	case RISK_TRADING_HOURS:
+		return "trading hours"
+	case RISK_ORDER_VOLUME:
+		return "order volume"
+	case RISK_SYMBOL_VOLUME:
+		return "symbol volume"
+	case RISK_OPEN_POSITIONS:
+		return "open positions"
+	case RISK_EXPOSURE:
+		return "exposure"
+	case RISK_DAILY_LOSS:
+		return "daily loss"
+	default:
+		return fmt.Sprintf("rule %d", int(r))
+	}
+}
+
+// RiskError is returned when an order is rejected by the risk manager.
+type RiskError struct {
+	Rule   RiskRule
+	Reason string
+}
+
+func (e *RiskError) Error() string {
+	return fmt.Sprintf("order rejected by %s limit: %s", e.Rule, e.Reason)
+}
+
+// TradingWindow is a daily window in which new orders are allowed. Start and
+// End are offsets from midnight in Location, an empty Days allows every day.
+// A window with End not after Start wraps past midnight and belongs to the day
+// it starts on, e.g. Start 22h and End 2h on Friday ends on Saturday 2:00.
+type TradingWindow struct {
+	Days     []time.Weekday
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+func (w TradingWindow) Contains(t time.Time) bool {
+
+	if w.Location != nil {
+		t = t.In(w.Location)
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	day := t.Weekday()
+
+	if w.End > w.Start {
+		if offset < w.Start || offset >= w.End {
+			return false
+		}
+	} else {
+		switch {
+		case offset >= w.Start:
+		case offset < w.End:
+			day = (day + 6) % 7
+		default:
+			return false
+		}
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RiskLimits configures the risk manager, zero values disable the limit.
+type RiskLimits struct {
+	MaxOrderVolume     float64            // Lots per order
+	MaxSymbolVolume    float64            // Lots open per symbol, unless overridden below
+	SymbolVolumeLimits map[string]float64 // Lots open per symbol
+	MaxOpenPositions   int
+	MaxExposure        float64 // Used margin plus margin and commission of the order, in account currency
+	DailyLossLimit     float64 // Equity drop since the start of the day, in account currency
+	DayLocation        *time.Location
+	AllowedSymbols     []string
+	TradingWindows     []TradingWindow
+}
+
+// RiskManager guards TradeTransaction with pre-trade checks. Only opening
+// orders are checked, closing, modifying and deleting always pass so
+// positions can be reduced even when limits are breached. RiskManager is a
+// Broker itself, components given it instead of the wrapped broker have their
+// orders checked.
+type RiskManager struct {
+	Broker
+	limits   RiskLimits
+	calendar *TradingCalendar
+	clock    Clock
+
+	submitMu sync.Mutex // Serializes check and send of opening orders
+
+	mu          sync.Mutex
+	killed      bool
+	day         time.Time
+	dayEquity   float64
+	equity      float64
+	equityKnown bool
+}
+
+func NewRiskManager(api Broker, limits RiskLimits) *RiskManager {
+
+	if limits.DayLocation == nil {
+		limits.DayLocation = time.UTC
+	}
+
+	return &RiskManager{
+		Broker: api,
+		limits: limits,
+		clock:  SystemClock,
+	}
+}
+
+// SetClock decides which trading window applies and when the daily loss
+// limit starts a new day.
+func (r *RiskManager) SetClock(clock Clock) {
+	r.clock = clock
+}
+
+// SetTradingCalendar makes the manager reject orders for closed markets.
+func (r *RiskManager) SetTradingCalendar(calendar *TradingCalendar) {
+	r.calendar = calendar
+}
+
+// HandleBalance is a GetBalanceCb tracking the equity for the daily loss limit.
+func (r *RiskManager) HandleBalance(balance Balance) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.updateEquity(balance.Equity)
+}
+
+// Kill blocks all new orders. With flatten, all open positions are closed
+// and pending orders deleted.
+func (r *RiskManager) Kill(ctx context.Context, flatten bool) ([]CloseResult, error) {
+
+	r.mu.Lock()
+	r.killed = true
+	r.mu.Unlock()
+
+	if !flatten {
+		return nil, nil
+	}
+
+	results, err := CloseAll(ctx, r.Broker)
+	if err != nil {
+		return results, fmt.Errorf("unable to flatten: %w", err)
+	}
+
+	trades, err := r.Broker.GetTrades(ctx, true)
+	if err != nil {
+		return results, fmt.Errorf("unable to flatten: %w", err)
+	}
+
+	var errs []error
+	for _, rec := range trades {
+		if isMarketCmd(TradeCmd(rec.Cmd)) {
+			continue
+		}
+		if _, err := PlaceOrder(ctx, r.Broker, DeletePending(rec.Symbol, TradeCmd(rec.Cmd), rec.Order)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to delete order %d: %w", rec.Order, err))
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// Resume releases the kill switch.
+func (r *RiskManager) Resume() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.killed = false
+}
+
+func (r *RiskManager) Killed() bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.killed
+}
+
+// TradeTransaction checks the transaction and sends it when all limits pass.
+// Opening orders are checked and sent one at a time, so concurrent orders
+// can not pass the limits together.
+func (r *RiskManager) TradeTransaction(ctx context.Context, info TransactionInfo) (OrderId, error) {
+
+	if info.Type == TYPE_OPEN {
+		r.submitMu.Lock()
+		defer r.submitMu.Unlock()
+	}
+
+	if err := r.Check(ctx, info); err != nil {
+		return OrderId{}, err
+	}
+
+	return r.Broker.TradeTransaction(ctx, info)
+}
+
+// Check verifies the transaction against all limits, a *RiskError is
+// returned for rejections.
+func (r *RiskManager) Check(ctx context.Context, info TransactionInfo) error {
+
+	if info.Type != TYPE_OPEN {
+		return nil
+	}
+
+	if r.Killed() {
+		return &RiskError{RISK_KILL_SWITCH, "new orders are blocked"}
+	}
+
+	if err := r.checkStatic(info); err != nil {
+		return err
+	}
+
+	if r.calendar != nil {
+		if err := r.calendar.CheckOrder(ctx, info); errors.Is(err, ErrMarketClosed) {
+			return &RiskError{RISK_TRADING_HOURS, err.Error()}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := r.checkPositions(ctx, info); err != nil {
+		return err
+	}
+
+	if err := r.checkExposure(ctx, info); err != nil {
+		return err
+	}
+
+	return r.checkDailyLoss(ctx)
+}
+
+func (r *RiskManager) checkStatic(info TransactionInfo) error {
+
+	if len(r.limits.AllowedSymbols) > 0 {
+		allowed := false
+		for _, symbol := range r.limits.AllowedSymbols {
+			if symbol == info.Symbol {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &RiskError{RISK_SYMBOL_NOT_ALLOWED, info.Symbol}
+		}
+	}
+
+	if len(r.limits.TradingWindows) > 0 {
+		now := r.clock.Now()
+		inside := false
+		for _, window := range r.limits.TradingWindows {
+			if window.Contains(now) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return &RiskError{RISK_TRADING_HOURS, fmt.Sprintf("%v is outside of trading windows", now)}
+		}
+	}
+
+	if r.limits.MaxOrderVolume > 0 && info.Volume > r.limits.MaxOrderVolume+volumeEpsilon {
+		return &RiskError{RISK_ORDER_VOLUME, fmt.Sprintf("%v exceeds %v", info.Volume, r.limits.MaxOrderVolume)}
+	}
+
+	return nil
+}
+
+func (r *RiskManager) checkPositions(ctx context.Context, info TransactionInfo) error {
+
+	maxSymbolVolume := r.limits.MaxSymbolVolume
+	if limit, exists := r.limits.SymbolVolumeLimits[info.Symbol]; exists {
+		maxSymbolVolume = limit
+	}
+
+	if maxSymbolVolume <= 0 && r.limits.MaxOpenPositions <= 0 {
+		return nil
+	}
+
+	trades, err := r.Broker.GetTrades(ctx, true)
+	if err != nil {
+		return fmt.Errorf("unable to check open positions: %w", err)
+	}
+
+	positions := 0
+	symbolVolume := info.Volume
+	for _, rec := range trades {
+		if isMarketCmd(TradeCmd(rec.Cmd)) {
+			positions++
+		}
+		// Pending orders count, they may fill at any time
+		if rec.Symbol == info.Symbol {
+			symbolVolume += rec.Volume
+		}
+	}
+
+	if maxSymbolVolume > 0 && symbolVolume > maxSymbolVolume+volumeEpsilon {
+		return &RiskError{RISK_SYMBOL_VOLUME, fmt.Sprintf("%v lots of %s exceed %v", symbolVolume, info.Symbol, maxSymbolVolume)}
+	}
+
+	if r.limits.MaxOpenPositions > 0 && positions >= r.limits.MaxOpenPositions {
+		return &RiskError{RISK_OPEN_POSITIONS, fmt.Sprintf("%d positions already open", positions)}
+	}
+
+	return nil
+}
+
+func (r *RiskManager) checkExposure(ctx context.Context, info TransactionInfo) error {
+
+	if r.limits.MaxExposure <= 0 {
+		return nil
+	}
+
+	margin, err := r.Broker.GetMarginLevel(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to check exposure: %w", err)
+	}
+
+	orderMargin, err := r.Broker.GetMarginTrade(ctx, info.Symbol, float32(info.Volume))
+	if err != nil {
+		return fmt.Errorf("unable to check exposure: %w", err)
+	}
+
+	commission, err := r.Broker.GetCommissionDef(ctx, info.Symbol, float32(info.Volume))
+	if err != nil {
+		return fmt.Errorf("unable to check exposure: %w", err)
+	}
+
+	exposure := margin.Margin + float64(orderMargin) + commission.Commission
+	if exposure > r.limits.MaxExposure {
+		return &RiskError{RISK_EXPOSURE, fmt.Sprintf("%.2f %s exceeds %.2f", exposure, margin.Currency, r.limits.MaxExposure)}
+	}
+
+	return nil
+}
+
+func (r *RiskManager) checkDailyLoss(ctx context.Context) error {
+
+	if r.limits.DailyLossLimit <= 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	known := r.equityKnown
+	r.mu.Unlock()
+
+	// Without the balance stream the equity is polled
+	if !known {
+		margin, err := r.Broker.GetMarginLevel(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to check daily loss: %w", err)
+		}
+		r.mu.Lock()
+		r.updateEquity(margin.Equity)
+		r.equityKnown = false
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	loss := r.dayEquity - r.equity
+	r.mu.Unlock()
+
+	if loss >= r.limits.DailyLossLimit {
+		return &RiskError{RISK_DAILY_LOSS, fmt.Sprintf("loss %.2f reached %.2f", loss, r.limits.DailyLossLimit)}
+	}
+
+	return nil
+}
+
+// updateEquity must be called with the lock held.
+func (r *RiskManager) updateEquity(equity float64) {
+
+	now := r.clock.Now().In(r.limits.DayLocation)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if !day.Equal(r.day) {
+		r.day = day
+		r.dayEquity = equity
+	}
+
+	r.equity = equity
+	r.equityKnown = true
+}
@@ -0,0 +1,1026 @@
+package gxtb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+type SimulatorOptions struct {
+	Currency         string         // Account currency
+	Balance          float64        // Initial balance
+	CommissionPerLot float64        // Charged on open, in account currency
+	CommissionRate   float64        // Charged on open as a fraction of the notional value
+	Location         *time.Location // Swaps are charged at midnight in Location
+}
+
+func DefaultSimulatorOptions() SimulatorOptions {
+	return SimulatorOptions{
+		Currency: "USD",
+		Balance:  10000,
+		Location: brokerLocation(),
+	}
+}
+
+// Simulator is a paper trading broker. It accepts the TransactionInfo requests
+// of ApiClient, fills market and pending orders against the ticks fed to
+// HandleTick and emits the trades, trade status, balance and profits stream
+// messages through Stream. The clock of the simulator is the timestamp of the
+// last tick, so replayed ticks give reproducible results.
+//
+// Market orders fill on the current bid or ask, so the spread is the one of
+// the ticks. Like on the server, positions get their own numbers and carry the
+// order they were opened by in Order2. Commission is charged on open, swaps at rollover following the
+// swap settings of the symbol.
+type Simulator struct {
+	opts SimulatorOptions
+
+	mu        sync.Mutex
+	now       time.Time
+	rollover  time.Time
+	symbols   map[string]SymbolInfo
+	nextOrder int
+	balance   float64
+	positions map[int]*TradeRecord // Open positions by order number
+	pending   map[int]*TradeRecord // Pending orders by order number
+	history   []TradeRecord
+	statuses  map[int]TransactionStatus
+
+	tradesCb      GetTradesCb
+	tradeStatusCb GetTradeStatusCb
+	balanceCb     GetBalanceCb
+	profitsCb     GetProfitsCb
+}
+
+// simEvent is a stream message, exactly one field is set.
+type simEvent struct {
+	trade   *Trade
+	status  *TradeStatus
+	profit  *Profit
+	balance *Balance
+}
+
+func NewSimulator(symbols []SymbolInfo, opts SimulatorOptions) *Simulator {
+
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
+	s := &Simulator{
+		opts:      opts,
+		symbols:   make(map[string]SymbolInfo, len(symbols)),
+		nextOrder: 1,
+		balance:   opts.Balance,
+		positions: make(map[int]*TradeRecord),
+		pending:   make(map[int]*TradeRecord),
+		statuses:  make(map[int]TransactionStatus),
+	}
+
+	for _, info := range symbols {
+		s.symbols[info.Symbol] = info
+	}
+
+	return s
+}
+
+// Stream returns the stream side of the simulator.
+func (s *Simulator) Stream() *SimulatorStream {
+	return &SimulatorStream{s}
+}
+
+// IsDemo reports true, the simulator never trades real money.
+func (s *Simulator) IsDemo() bool {
+	return true
+}
+
+// Now returns the simulated time, the timestamp of the last tick. The
+// simulator is a Clock for components given it through SetClock.
+func (s *Simulator) Now() time.Time {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.now
+}
+
+func (s *Simulator) GetAllSymbols(ctx context.Context) ([]SymbolInfo, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbols := make([]SymbolInfo, 0, len(s.symbols))
+	for _, info := range s.symbols {
+		symbols = append(symbols, info)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Symbol < symbols[j].Symbol
+	})
+
+	return symbols, nil
+}
+
+// GetSymbol returns the symbol with the prices of the last tick.
+func (s *Simulator) GetSymbol(ctx context.Context, symbol string) (SymbolInfo, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.symbols[symbol]
+	if !exists {
+		return info, fmt.Errorf("%w: %s", ErrInvalidSymbol, symbol)
+	}
+
+	return info, nil
+}
+
+func (s *Simulator) GetServerTime(ctx context.Context) (ServerTime, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return ServerTime{s.now.UnixMilli(), s.now.String()}, nil
+}
+
+func (s *Simulator) GetCurrentUserData(ctx context.Context) (UserData, error) {
+
+	return UserData{Currency: s.opts.Currency, SpreadType: "FLOAT"}, nil
+}
+
+func (s *Simulator) GetMarginLevel(ctx context.Context) (MarginData, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance := s.balanceLocked()
+
+	return MarginData{
+		Balance:     balance.Balance,
+		Currency:    s.opts.Currency,
+		Equity:      balance.Equity,
+		Margin:      balance.Margin,
+		MarginFree:  balance.MarginFree,
+		MarginLevel: balance.MarginLevel,
+	}, nil
+}
+
+func (s *Simulator) GetMarginTrade(ctx context.Context, symbol string, volume float32) (float32, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.symbols[symbol]
+	if !exists {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidSymbol, symbol)
+	}
+
+	margin, ok := s.margin(info, float64(volume), info.Ask)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s to %s", ErrNoConversion, info.CurrencyProfit, s.opts.Currency)
+	}
+
+	return float32(margin), nil
+}
+
+func (s *Simulator) GetCommissionDef(ctx context.Context, symbol string, volume float32) (CommissionData, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.symbols[symbol]
+	if !exists {
+		return CommissionData{}, fmt.Errorf("%w: %s", ErrInvalidSymbol, symbol)
+	}
+
+	rate, ok := s.conversionRate(info.CurrencyProfit, s.opts.Currency)
+	if !ok {
+		return CommissionData{}, fmt.Errorf("%w: %s to %s", ErrNoConversion, info.CurrencyProfit, s.opts.Currency)
+	}
+
+	commission := s.commission(info, float64(volume), info.Ask, rate)
+	if commission != 0 {
+		commission = -commission
+	}
+
+	return CommissionData{
+		Commission:     commission,
+		RateOfExchange: rate,
+	}, nil
+}
+
+// GetTrades returns the open positions and pending orders, and the closed
+// trades unless openedOnly is set.
+func (s *Simulator) GetTrades(ctx context.Context, openedOnly bool) ([]TradeRecord, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var trades []TradeRecord
+	for _, rec := range s.positions {
+		trades = append(trades, *rec)
+	}
+	for _, rec := range s.pending {
+		trades = append(trades, *rec)
+	}
+	if !openedOnly {
+		trades = append(trades, s.history...)
+	}
+
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].Order < trades[j].Order
+	})
+
+	return trades, nil
+}
+
+// GetTradeRecords returns the open and closed trades with the order numbers.
+func (s *Simulator) GetTradeRecords(ctx context.Context, orders []int) ([]TradeRecord, error) {
+
+	trades, _ := s.GetTrades(ctx, true)
+
+	s.mu.Lock()
+	trades = append(trades, s.history...)
+	s.mu.Unlock()
+
+	var records []TradeRecord
+	for _, rec := range trades {
+		for _, order := range orders {
+			if rec.Order == order {
+				records = append(records, rec)
+				break
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// GetTradesHistory returns the trades closed between start and end in unix
+// milliseconds, zero end means now.
+func (s *Simulator) GetTradesHistory(ctx context.Context, end, start int) ([]TradeRecord, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []TradeRecord
+	for _, rec := range s.history {
+		if *rec.CloseTime < int64(start) || (end != 0 && *rec.CloseTime > int64(end)) {
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// TradeTransaction executes the transaction. Invalid requests return an
+// error, requests the market can not fill right now are rejected through the
+// transaction status like on the server.
+func (s *Simulator) TradeTransaction(ctx context.Context, info TransactionInfo) (OrderId, error) {
+
+	s.mu.Lock()
+
+	id := s.nextOrder
+	s.nextOrder++
+
+	events, err := s.transaction(id, info)
+	if err != nil {
+		s.mu.Unlock()
+		return OrderId{}, fmt.Errorf("unable to process simulated tradeTransaction: %w", err)
+	}
+
+	s.mu.Unlock()
+
+	s.emit(events)
+
+	return OrderId{id}, nil
+}
+
+func (s *Simulator) TradeTransactionStatus(ctx context.Context, orderId int) (TransactionStatus, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, exists := s.statuses[orderId]
+	if !exists {
+		return status, fmt.Errorf("%w: %d", ErrPositionNotFound, orderId)
+	}
+
+	return status, nil
+}
+
+// HandleTick is a GetTickPricesCb moving the market of the simulator. Pending
+// orders, stop losses and take profits of the symbol are checked against
+// the new prices.
+func (s *Simulator) HandleTick(tick TickPrice) {
+
+	if tick.Level != 0 {
+		return
+	}
+
+	s.mu.Lock()
+
+	info, exists := s.symbols[tick.Symbol]
+	if !exists {
+		s.mu.Unlock()
+		return
+	}
+
+	info.Bid, info.Ask = tick.Bid, tick.Ask
+	if info.Ask == 0 {
+		info.Ask = info.Bid + info.SpreadRaw
+	}
+	info.Time = tick.Timestamp
+	s.symbols[tick.Symbol] = info
+
+	if ts := time.UnixMilli(tick.Timestamp); ts.After(s.now) {
+		s.now = ts
+	}
+
+	var events []simEvent
+	events = append(events, s.chargeSwaps()...)
+	events = append(events, s.checkPending(info)...)
+	events = append(events, s.checkStops(info)...)
+	events = append(events, s.updateProfits(info)...)
+	balance := s.balanceLocked()
+	events = append(events, simEvent{balance: &balance})
+
+	s.mu.Unlock()
+
+	s.emit(events)
+}
+
+// transaction must be called with the lock held.
+func (s *Simulator) transaction(id int, info TransactionInfo) ([]simEvent, error) {
+
+	switch info.Type {
+	case TYPE_OPEN:
+		symbol, exists := s.symbols[info.Symbol]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSymbol, info.Symbol)
+		}
+		if err := validateVolume(info.Volume, symbol); err != nil {
+			return nil, err
+		}
+		if isMarketCmd(info.Cmd) {
+			return s.openMarket(id, info, symbol), nil
+		}
+		if info.Price <= 0 {
+			return nil, fmt.Errorf("%w: pending order needs a price", ErrInvalidPrice)
+		}
+		return s.placePending(id, info, symbol), nil
+	case TYPE_CLOSE:
+		rec := s.findPosition(info.Order)
+		if rec == nil {
+			return nil, fmt.Errorf("%w: %d", ErrPositionNotFound, info.Order)
+		}
+		volume := info.Volume
+		if volume <= 0 || volume > rec.Volume+volumeEpsilon {
+			return nil, fmt.Errorf("%w: unable to close %v of %v lots of %d", ErrInvalidVolume, volume, rec.Volume, rec.Order)
+		}
+		events := s.closePosition(rec, math.Min(volume, rec.Volume))
+		closed := s.history[len(s.history)-1]
+		return append(events, s.accept(id, info.CustomComment, closed.ClosePrice)), nil
+	case TYPE_MODIFY:
+		return s.modify(id, info)
+	case TYPE_DELETE:
+		rec, exists := s.pending[info.Order]
+		if !exists {
+			return nil, fmt.Errorf("%w: %d", ErrPositionNotFound, info.Order)
+		}
+		delete(s.pending, info.Order)
+		trade := RecordToTrade(*rec, TRADE_STATE_DELETED)
+		return []simEvent{{trade: &trade}, s.accept(id, info.CustomComment, rec.OpenPrice)}, nil
+	default:
+		return nil, fmt.Errorf("transaction type %d is not supported", info.Type)
+	}
+}
+
+// openMarket fills the market order of a transaction. Like the server, it
+// streams the order as pending and deleted before the position opens. It must
+// be called with the lock held.
+func (s *Simulator) openMarket(order int, info TransactionInfo, symbol SymbolInfo) []simEvent {
+
+	events := s.openPosition(order, info, symbol)
+	if events[0].trade == nil {
+		return events
+	}
+
+	booked := RecordToTrade(TradeRecord{
+		Cmd:           int(info.Cmd),
+		CustomComment: info.CustomComment,
+		Digits:        symbol.Precision,
+		OpenTime:      s.now.UnixMilli(),
+		Order:         order,
+		Position:      order,
+		SL:            info.Sl,
+		Symbol:        info.Symbol,
+		Timestamp:     s.now.UnixMilli(),
+		TP:            info.Tp,
+		Volume:        info.Volume,
+	}, TRADE_STATE_MODIFIED)
+	booked.TradeType = int(TYPE_PENDING)
+	deleted := booked
+	deleted.State = TRADE_STATE_DELETED
+
+	return append([]simEvent{{trade: &booked}, {trade: &deleted}}, events...)
+}
+
+// openPosition fills the order, of a transaction or a triggered pending
+// order, with a position of a new number whose Order2 is the order. It must be
+// called with the lock held.
+func (s *Simulator) openPosition(order int, info TransactionInfo, symbol SymbolInfo) []simEvent {
+
+	if symbol.Bid <= 0 || symbol.Ask <= 0 {
+		return []simEvent{s.reject(order, info.CustomComment, "no price")}
+	}
+
+	price := symbol.Bid
+	if isBuyCmd(info.Cmd) {
+		price = symbol.Ask
+	}
+
+	rate, ok := s.conversionRate(symbol.CurrencyProfit, s.opts.Currency)
+	if !ok {
+		return []simEvent{s.reject(order, info.CustomComment, "no conversion to the account currency")}
+	}
+
+	margin, ok := s.margin(symbol, info.Volume, price)
+	if !ok {
+		return []simEvent{s.reject(order, info.CustomComment, "no conversion to the account currency")}
+	}
+
+	commission := s.commission(symbol, info.Volume, price, rate)
+	if balance := s.balanceLocked(); margin+commission > balance.MarginFree {
+		return []simEvent{s.reject(order, info.CustomComment, "not enough money")}
+	}
+
+	s.balance -= commission
+
+	id := s.nextOrder
+	s.nextOrder++
+
+	rec := &TradeRecord{
+		Cmd:           int(info.Cmd),
+		Commission:    -commission,
+		CustomComment: info.CustomComment,
+		Digits:        symbol.Precision,
+		MarginRate:    margin,
+		OpenPrice:     price,
+		OpenTime:      s.now.UnixMilli(),
+		Order:         id,
+		Order2:        order,
+		Position:      id,
+		SL:            info.Sl,
+		Symbol:        info.Symbol,
+		Timestamp:     s.now.UnixMilli(),
+		TP:            info.Tp,
+		Volume:        info.Volume,
+	}
+	s.positions[id] = rec
+
+	trade := RecordToTrade(*rec, TRADE_STATE_MODIFIED)
+	balance := s.balanceLocked()
+
+	return []simEvent{{trade: &trade}, s.accept(order, info.CustomComment, price), {balance: &balance}}
+}
+
+// placePending must be called with the lock held.
+func (s *Simulator) placePending(id int, info TransactionInfo, symbol SymbolInfo) []simEvent {
+
+	rec := &TradeRecord{
+		Cmd:           int(info.Cmd),
+		CustomComment: info.CustomComment,
+		Digits:        symbol.Precision,
+		OpenPrice:     info.Price,
+		OpenTime:      s.now.UnixMilli(),
+		Order:         id,
+		Position:      id,
+		SL:            info.Sl,
+		Symbol:        info.Symbol,
+		Timestamp:     s.now.UnixMilli(),
+		TP:            info.Tp,
+		Volume:        info.Volume,
+	}
+	if info.Expiration != 0 {
+		expiration := info.Expiration
+		rec.Expiration = &expiration
+	}
+	s.pending[id] = rec
+
+	trade := RecordToTrade(*rec, TRADE_STATE_MODIFIED)
+
+	return []simEvent{{trade: &trade}, s.accept(id, info.CustomComment, info.Price)}
+}
+
+// closePosition closes the volume of the position on the current price. It
+// must be called with the lock held.
+func (s *Simulator) closePosition(rec *TradeRecord, volume float64) []simEvent {
+
+	symbol := s.symbols[rec.Symbol]
+	price := symbol.Ask
+	if isBuyCmd(TradeCmd(rec.Cmd)) {
+		price = symbol.Bid
+	}
+
+	share := volume / rec.Volume
+
+	closed := *rec
+	closed.Volume = volume
+	closed.ClosePrice = price
+	closed.Closed = true
+	closeTime := s.now.UnixMilli()
+	closed.CloseTime = &closeTime
+	closed.Storage = roundDigits(rec.Storage*share, 2)
+	closed.Commission = roundDigits(rec.Commission*share, 2)
+	if profit, ok := s.profit(symbol, &closed); ok {
+		closed.Profit = profit
+	}
+	closed.MarginRate = rec.MarginRate * share
+
+	s.balance += closed.Profit + closed.Storage
+	s.history = append(s.history, closed)
+
+	trade := RecordToTrade(closed, TRADE_STATE_MODIFIED)
+	trade.TradeType = int(TYPE_CLOSE)
+	events := []simEvent{{trade: &trade}}
+
+	if volume >= rec.Volume-volumeEpsilon {
+		delete(s.positions, rec.Order)
+	} else {
+		rec.Volume = floorToStep(rec.Volume-volume, symbol.LotStep)
+		rec.Storage -= closed.Storage
+		rec.Commission -= closed.Commission
+		rec.MarginRate -= closed.MarginRate
+		rec.Timestamp = closeTime
+		remaining := RecordToTrade(*rec, TRADE_STATE_MODIFIED)
+		remaining.TradeType = int(TYPE_MODIFY)
+		events = append(events, simEvent{trade: &remaining})
+	}
+
+	balance := s.balanceLocked()
+	return append(events, simEvent{balance: &balance})
+}
+
+// modify must be called with the lock held.
+func (s *Simulator) modify(id int, info TransactionInfo) ([]simEvent, error) {
+
+	if rec := s.findPosition(info.Order); rec != nil {
+		rec.SL, rec.TP = info.Sl, info.Tp
+		rec.Timestamp = s.now.UnixMilli()
+		trade := RecordToTrade(*rec, TRADE_STATE_MODIFIED)
+		trade.TradeType = int(TYPE_MODIFY)
+		return []simEvent{{trade: &trade}, s.accept(id, info.CustomComment, rec.OpenPrice)}, nil
+	}
+
+	rec, exists := s.pending[info.Order]
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrPositionNotFound, info.Order)
+	}
+
+	if info.Price > 0 {
+		rec.OpenPrice = info.Price
+	}
+	if info.Volume > 0 {
+		if err := validateVolume(info.Volume, s.symbols[rec.Symbol]); err != nil {
+			return nil, err
+		}
+		rec.Volume = info.Volume
+	}
+	rec.SL, rec.TP = info.Sl, info.Tp
+	rec.Expiration = nil
+	if info.Expiration != 0 {
+		expiration := info.Expiration
+		rec.Expiration = &expiration
+	}
+	rec.Timestamp = s.now.UnixMilli()
+
+	trade := RecordToTrade(*rec, TRADE_STATE_MODIFIED)
+	return []simEvent{{trade: &trade}, s.accept(id, info.CustomComment, rec.OpenPrice)}, nil
+}
+
+// checkPending triggers and expires the pending orders of the symbol. It
+// must be called with the lock held.
+func (s *Simulator) checkPending(symbol SymbolInfo) []simEvent {
+
+	var events []simEvent
+
+	for _, order := range s.sortedOrders(s.pending, symbol.Symbol) {
+		rec := s.pending[order]
+
+		if rec.Expiration != nil && *rec.Expiration <= s.now.UnixMilli() {
+			delete(s.pending, order)
+			trade := RecordToTrade(*rec, TRADE_STATE_DELETED)
+			events = append(events, simEvent{trade: &trade})
+			continue
+		}
+
+		var triggered bool
+		switch TradeCmd(rec.Cmd) {
+		case CMD_BUY_LIMIT:
+			triggered = symbol.Ask <= rec.OpenPrice
+		case CMD_SELL_LIMIT:
+			triggered = symbol.Bid >= rec.OpenPrice
+		case CMD_BUY_STOP:
+			triggered = symbol.Ask >= rec.OpenPrice
+		case CMD_SELL_STOP:
+			triggered = symbol.Bid <= rec.OpenPrice
+		}
+		if !triggered {
+			continue
+		}
+
+		delete(s.pending, order)
+		deleted := RecordToTrade(*rec, TRADE_STATE_DELETED)
+		events = append(events, simEvent{trade: &deleted})
+
+		cmd := CMD_BUY
+		if !isBuyCmd(TradeCmd(rec.Cmd)) {
+			cmd = CMD_SELL
+		}
+
+		events = append(events, s.openPosition(order, TransactionInfo{
+			Cmd:           cmd,
+			CustomComment: rec.CustomComment,
+			Sl:            rec.SL,
+			Symbol:        rec.Symbol,
+			Tp:            rec.TP,
+			Type:          TYPE_OPEN,
+			Volume:        rec.Volume,
+		}, symbol)...)
+	}
+
+	return events
+}
+
+// checkStops closes the positions of the symbol hitting their stop loss or
+// take profit. It must be called with the lock held.
+func (s *Simulator) checkStops(symbol SymbolInfo) []simEvent {
+
+	var events []simEvent
+
+	for _, order := range s.sortedOrders(s.positions, symbol.Symbol) {
+		rec := s.positions[order]
+
+		var hit bool
+		if isBuyCmd(TradeCmd(rec.Cmd)) {
+			hit = (rec.SL != 0 && symbol.Bid <= rec.SL) || (rec.TP != 0 && symbol.Bid >= rec.TP)
+		} else {
+			hit = (rec.SL != 0 && symbol.Ask >= rec.SL) || (rec.TP != 0 && symbol.Ask <= rec.TP)
+		}
+
+		if hit {
+			events = append(events, s.closePosition(rec, rec.Volume)...)
+		}
+	}
+
+	return events
+}
+
+// updateProfits must be called with the lock held.
+func (s *Simulator) updateProfits(symbol SymbolInfo) []simEvent {
+
+	var events []simEvent
+
+	for _, order := range s.sortedOrders(s.positions, symbol.Symbol) {
+		rec := s.positions[order]
+		profit, ok := s.profit(symbol, rec)
+		if !ok {
+			continue
+		}
+		rec.Profit = profit
+		events = append(events, simEvent{profit: &Profit{
+			Order:    rec.Order,
+			Order2:   rec.Order2,
+			Position: rec.Position,
+			Profit:   profit,
+		}})
+	}
+
+	return events
+}
+
+// chargeSwaps charges the swaps of all open positions for every rollover
+// passed since the last tick. Rollovers happen at midnight starting Tuesday
+// to Saturday, the day given by SwapRollover3Days of the symbol is charged
+// three times for the weekend. It must be called with the lock held.
+func (s *Simulator) chargeSwaps() []simEvent {
+
+	local := s.now.In(s.opts.Location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.opts.Location)
+
+	if s.rollover.IsZero() {
+		s.rollover = day
+		return nil
+	}
+
+	var events []simEvent
+
+	for s.rollover.Before(day) {
+		ended := s.rollover.Weekday()
+		s.rollover = s.rollover.AddDate(0, 0, 1)
+
+		if ended == time.Saturday || ended == time.Sunday {
+			continue
+		}
+
+		for _, order := range s.sortedOrders(s.positions, "") {
+			rec := s.positions[order]
+			symbol := s.symbols[rec.Symbol]
+
+			swap, ok := s.swap(symbol, rec)
+			if !ok || swap == 0 {
+				continue
+			}
+			if int(ended) == int(symbol.SwapRollover3Days) {
+				swap *= 3
+			}
+
+			rec.Storage = roundDigits(rec.Storage+swap, 2)
+			trade := RecordToTrade(*rec, TRADE_STATE_MODIFIED)
+			trade.TradeType = int(TYPE_MODIFY)
+			events = append(events, simEvent{trade: &trade})
+		}
+	}
+
+	return events
+}
+
+// swap returns the swap of one rollover in account currency.
+func (s *Simulator) swap(symbol SymbolInfo, rec *TradeRecord) (float64, bool) {
+
+	if !symbol.SwapEnable {
+		return 0, true
+	}
+
+	rate := symbol.SwapLong
+	if !isBuyCmd(TradeCmd(rec.Cmd)) {
+		rate = symbol.SwapShort
+	}
+
+	var amount float64
+	currency := symbol.CurrencyProfit
+
+	switch symbol.SwapType {
+	case SWAP_TYPE_POINTS:
+		amount = rate * symbol.PointValue() * rec.Volume
+	case SWAP_TYPE_BASE_CURRENCY:
+		amount, currency = rate*rec.Volume, symbol.Currency
+	case SWAP_TYPE_INTEREST:
+		amount = rec.Volume * float64(symbol.ContractSize) * rec.OpenPrice * rate / 100 / 360
+	case SWAP_TYPE_MARGIN_CURRENCY:
+		amount = rate * rec.Volume
+		if symbol.MarginMode == MARGIN_MODE_FOREX {
+			currency = symbol.Currency
+		}
+	}
+
+	conversion, ok := s.conversionRate(currency, s.opts.Currency)
+	return amount * conversion, ok
+}
+
+// profit returns the profit of the record closed on the current price in
+// account currency.
+func (s *Simulator) profit(symbol SymbolInfo, rec *TradeRecord) (float64, bool) {
+
+	price := rec.ClosePrice
+	if !rec.Closed {
+		price = symbol.Ask
+		if isBuyCmd(TradeCmd(rec.Cmd)) {
+			price = symbol.Bid
+		}
+	}
+
+	diff := price - rec.OpenPrice
+	if !isBuyCmd(TradeCmd(rec.Cmd)) {
+		diff = -diff
+	}
+
+	rate, ok := s.conversionRate(symbol.CurrencyProfit, s.opts.Currency)
+	if !ok {
+		return 0, false
+	}
+
+	return roundDigits(diff/symbol.Point()*symbol.PointValue()*rec.Volume*rate, 2), true
+}
+
+// margin returns the margin of the volume in account currency. Symbol
+// leverage is the margin percentage, forex margin is in the base currency,
+// CFD margin in the profit currency.
+func (s *Simulator) margin(symbol SymbolInfo, volume, price float64) (float64, bool) {
+
+	leverage := symbol.Leverage
+	if leverage <= 0 {
+		leverage = 100
+	}
+
+	notional := volume * float64(symbol.ContractSize) * leverage / 100
+	currency := symbol.Currency
+	if symbol.MarginMode != MARGIN_MODE_FOREX {
+		notional *= price
+		currency = symbol.CurrencyProfit
+	}
+
+	rate, ok := s.conversionRate(currency, s.opts.Currency)
+	return roundDigits(notional*rate, 2), ok
+}
+
+// commission returns the commission of the volume in account currency, rate
+// converts the profit currency into the account currency.
+func (s *Simulator) commission(symbol SymbolInfo, volume, price, rate float64) float64 {
+
+	notional := volume * float64(symbol.ContractSize) * price * rate
+	return roundDigits(s.opts.CommissionPerLot*volume+s.opts.CommissionRate*notional, 2)
+}
+
+// conversionRate returns how many units of to one unit of from is worth,
+// using the prices of the from+to or to+from symbol.
+func (s *Simulator) conversionRate(from, to string) (float64, bool) {
+
+	if from == "" || from == to {
+		return 1, true
+	}
+
+	if pair, exists := s.symbols[from+to]; exists && pair.Bid > 0 {
+		return pair.Bid, true
+	}
+
+	if pair, exists := s.symbols[to+from]; exists && pair.Ask > 0 {
+		return 1 / pair.Ask, true
+	}
+
+	return 0, false
+}
+
+// balanceLocked must be called with the lock held.
+func (s *Simulator) balanceLocked() Balance {
+
+	balance := Balance{Balance: roundDigits(s.balance, 2)}
+
+	equity := s.balance
+	for _, rec := range s.positions {
+		equity += rec.Profit + rec.Storage
+		balance.Margin += rec.MarginRate
+	}
+
+	balance.Equity = roundDigits(equity, 2)
+	balance.Margin = roundDigits(balance.Margin, 2)
+	balance.MarginFree = roundDigits(equity-balance.Margin, 2)
+	if balance.Margin > 0 {
+		balance.MarginLevel = roundDigits(equity/balance.Margin*100, 2)
+	}
+
+	return balance
+}
+
+// findPosition looks up an open position by order or position number.
+func (s *Simulator) findPosition(order int) *TradeRecord {
+
+	if rec, exists := s.positions[order]; exists {
+		return rec
+	}
+
+	for _, rec := range s.positions {
+		if rec.Position == order {
+			return rec
+		}
+	}
+
+	return nil
+}
+
+// sortedOrders returns the order numbers of the symbol in ascending order,
+// all symbols when empty, so processing does not depend on map order.
+func (s *Simulator) sortedOrders(records map[int]*TradeRecord, symbol string) []int {
+
+	var orders []int
+	for order, rec := range records {
+		if symbol == "" || rec.Symbol == symbol {
+			orders = append(orders, order)
+		}
+	}
+
+	sort.Ints(orders)
+	return orders
+}
+
+// accept must be called with the lock held.
+func (s *Simulator) accept(id int, customComment string, price float64) simEvent {
+
+	s.statuses[id] = TransactionStatus{
+		CustomComment: customComment,
+		Order:         id,
+		RequestStatus: REQUEST_STATUS_ACCEPTED,
+	}
+
+	return simEvent{status: &TradeStatus{
+		CustomComment: customComment,
+		Order:         id,
+		Price:         price,
+		RequestStatus: int(REQUEST_STATUS_ACCEPTED),
+	}}
+}
+
+// reject must be called with the lock held.
+func (s *Simulator) reject(id int, customComment, message string) simEvent {
+
+	s.statuses[id] = TransactionStatus{
+		CustomComment: customComment,
+		Message:       &message,
+		Order:         id,
+		RequestStatus: REQUEST_STATUS_REJECTED,
+	}
+
+	return simEvent{status: &TradeStatus{
+		CustomComment: customComment,
+		Message:       &message,
+		Order:         id,
+		RequestStatus: int(REQUEST_STATUS_REJECTED),
+	}}
+}
+
+func (s *Simulator) emit(events []simEvent) {
+
+	s.mu.Lock()
+	tradesCb, tradeStatusCb := s.tradesCb, s.tradeStatusCb
+	balanceCb, profitsCb := s.balanceCb, s.profitsCb
+	s.mu.Unlock()
+
+	for _, event := range events {
+		switch {
+		case event.trade != nil && tradesCb != nil:
+			tradesCb(*event.trade)
+		case event.status != nil && tradeStatusCb != nil:
+			tradeStatusCb(*event.status)
+		case event.profit != nil && profitsCb != nil:
+			profitsCb(*event.profit)
+		case event.balance != nil && balanceCb != nil:
+			balanceCb(*event.balance)
+		}
+	}
+}
+
+// SimulatorStream provides the account streams of a Simulator with the
+// methods of StreamClient.
+type SimulatorStream struct {
+	sim *Simulator
+}
+
+func (c *SimulatorStream) IsDemo() bool {
+	return true
+}
+
+func (c *SimulatorStream) GetTrades(ctx context.Context, cb GetTradesCb) error {
+
+	c.sim.mu.Lock()
+	defer c.sim.mu.Unlock()
+
+	c.sim.tradesCb = cb
+	return nil
+}
+
+func (c *SimulatorStream) StopTrades(ctx context.Context) error {
+	return c.GetTrades(ctx, nil)
+}
+
+func (c *SimulatorStream) GetTradeStatus(ctx context.Context, cb GetTradeStatusCb) error {
+
+	c.sim.mu.Lock()
+	defer c.sim.mu.Unlock()
+
+	c.sim.tradeStatusCb = cb
+	return nil
+}
+
+func (c *SimulatorStream) StopTradeStatus(ctx context.Context) error {
+	return c.GetTradeStatus(ctx, nil)
+}
+
+func (c *SimulatorStream) GetBalance(ctx context.Context, cb GetBalanceCb) error {
+
+	c.sim.mu.Lock()
+	defer c.sim.mu.Unlock()
+
+	c.sim.balanceCb = cb
+	return nil
+}
+
+func (c *SimulatorStream) StopBalance(ctx context.Context) error {
+	return c.GetBalance(ctx, nil)
+}
+
+func (c *SimulatorStream) GetProfits(ctx context.Context, cb GetProfitsCb) error {
+
+	c.sim.mu.Lock()
+	defer c.sim.mu.Unlock()
+
+	c.sim.profitsCb = cb
+	return nil
+}
+
+func (c *SimulatorStream) StopProfits(ctx context.Context) error {
+	return c.GetProfits(ctx, nil)
+}
@@ -0,0 +1,193 @@
+package gxtb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newEURUSDSimulator returns a simulator quoting EURUSD at 1.1000/1.1002 on
+// Monday noon, recording its trades and trade statuses streams.
+func newEURUSDSimulator(symbol SymbolInfo) (*Simulator, *[]Trade, *[]TradeStatus) {
+
+	symbol.Symbol = "EURUSD"
+	symbol.Currency = "EUR"
+	symbol.CurrencyProfit = "USD"
+	symbol.ContractSize = 100000
+	symbol.Leverage = 5
+	symbol.LotMin = 0.01
+	symbol.LotStep = 0.01
+	symbol.MarginMode = MARGIN_MODE_FOREX
+	symbol.Precision = 5
+
+	sim := NewSimulator([]SymbolInfo{symbol}, SimulatorOptions{Currency: "USD", Balance: 10000, Location: time.UTC})
+	sim.HandleTick(TickPrice{Symbol: "EURUSD", Bid: 1.1, Ask: 1.1002, Timestamp: time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC).UnixMilli()})
+
+	var trades []Trade
+	var statuses []TradeStatus
+	stream := sim.Stream()
+	stream.GetTrades(context.Background(), func(trade Trade) { trades = append(trades, trade) })
+	stream.GetTradeStatus(context.Background(), func(status TradeStatus) { statuses = append(statuses, status) })
+
+	return sim, &trades, &statuses
+}
+
+func TestSimulatorMarketOrderLifecycle(t *testing.T) {
+
+	ctx := context.Background()
+	sim, trades, statuses := newEURUSDSimulator(SymbolInfo{})
+
+	id, err := PlaceOrder(ctx, sim, MarketBuy("EURUSD", 1).Comment("gx-1"))
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	// The order is booked and deleted before the position opens under a new
+	// number, like on the server
+	if len(*trades) != 3 {
+		t.Fatalf("got %d trades, want 3: %+v", len(*trades), *trades)
+	}
+	booked, deleted, opened := (*trades)[0], (*trades)[1], (*trades)[2]
+	if booked.Order != id.Id || booked.TradeType != int(TYPE_PENDING) || booked.State != TRADE_STATE_MODIFIED {
+		t.Errorf("booked order %+v", booked)
+	}
+	if deleted.Order != id.Id || deleted.State != TRADE_STATE_DELETED {
+		t.Errorf("deleted order %+v", deleted)
+	}
+	if opened.Order2 != id.Id || opened.Order == id.Id || opened.TradeType != int(TYPE_OPEN) || opened.OpenPrice != 1.1002 || opened.CustomComment != "gx-1" {
+		t.Errorf("opened position %+v", opened)
+	}
+	if len(*statuses) != 1 || (*statuses)[0].Order != id.Id || (*statuses)[0].RequestStatus != int(REQUEST_STATUS_ACCEPTED) {
+		t.Errorf("statuses %+v, want order %d accepted", *statuses, id.Id)
+	}
+
+	*trades = nil
+	sim.HandleTick(TickPrice{Symbol: "EURUSD", Bid: 1.1012, Ask: 1.1014, Timestamp: time.Date(2024, 1, 8, 12, 1, 0, 0, time.UTC).UnixMilli()})
+
+	if _, err := PlaceOrder(ctx, sim, ModifyPosition("EURUSD", CMD_BUY, opened.Order).StopLoss(1.1)); err != nil {
+		t.Fatalf("modify: %v", err)
+	}
+	if _, err := PlaceOrder(ctx, sim, ClosePosition("EURUSD", CMD_BUY, opened.Order, 0.4)); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if len(*trades) != 3 {
+		t.Fatalf("got %d trades, want 3: %+v", len(*trades), *trades)
+	}
+	modified, closed, remaining := (*trades)[0], (*trades)[1], (*trades)[2]
+	if modified.TradeType != int(TYPE_MODIFY) || modified.StopLoss != 1.1 {
+		t.Errorf("modified position %+v", modified)
+	}
+	if closed.TradeType != int(TYPE_CLOSE) || !closed.Closed || closed.Volume != 0.4 || closed.ClosePrice != 1.1012 || *closed.Profit != 40 {
+		t.Errorf("closed part %+v", closed)
+	}
+	if remaining.TradeType != int(TYPE_MODIFY) || remaining.Closed || remaining.Volume != 0.6 || remaining.Position != opened.Position {
+		t.Errorf("remaining part %+v", remaining)
+	}
+
+	open, _ := sim.GetTrades(ctx, true)
+	all, _ := sim.GetTrades(ctx, false)
+	if len(open) != 1 || len(all) != 2 {
+		t.Errorf("got %d open and %d of all trades, want 1 and 2", len(open), len(all))
+	}
+}
+
+func TestSimulatorRejectsCloseVolume(t *testing.T) {
+
+	ctx := context.Background()
+	sim, _, _ := newEURUSDSimulator(SymbolInfo{})
+
+	if _, err := PlaceOrder(ctx, sim, MarketSell("EURUSD", 1)); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	open, _ := sim.GetTrades(ctx, true)
+
+	for _, volume := range []float64{0, -1, 1.5} {
+		_, err := sim.TradeTransaction(ctx, TransactionInfo{Type: TYPE_CLOSE, Cmd: CMD_SELL, Symbol: "EURUSD", Order: open[0].Order, Volume: volume})
+		if !errors.Is(err, ErrInvalidVolume) {
+			t.Errorf("closing %v lots: %v, want ErrInvalidVolume", volume, err)
+		}
+	}
+
+	if still, _ := sim.GetTrades(ctx, true); len(still) != 1 || still[0].Volume != 1 {
+		t.Errorf("open trades %+v after rejected closes, want the whole position", still)
+	}
+}
+
+func TestSimulatorPendingOrders(t *testing.T) {
+
+	ctx := context.Background()
+	sim, _, _ := newEURUSDSimulator(SymbolInfo{})
+	tick := func(min int, bid float64) {
+		sim.HandleTick(TickPrice{Symbol: "EURUSD", Bid: bid, Ask: bid + 0.0002, Timestamp: time.Date(2024, 1, 8, 12, min, 0, 0, time.UTC).UnixMilli()})
+	}
+
+	limit, err := PlaceOrder(ctx, sim, LimitBuy("EURUSD", 1, 1.099).TakeProfit(1.101))
+	if err != nil {
+		t.Fatalf("limit: %v", err)
+	}
+	stop, err := PlaceOrder(ctx, sim, StopSell("EURUSD", 1, 1.098).StopLoss(1.1))
+	if err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	// The ask reaches the limit, the bid stays above the stop
+	tick(1, 1.0987)
+	open, _ := sim.GetTrades(ctx, true)
+	if len(open) != 2 {
+		t.Fatalf("got %d open trades, want the position and the stop order", len(open))
+	}
+	var position TradeRecord
+	for _, rec := range open {
+		if isMarketCmd(TradeCmd(rec.Cmd)) {
+			position = rec
+		}
+	}
+	if position.Order2 != limit.Id || position.OpenPrice != 1.0989 || position.TP != 1.101 {
+		t.Fatalf("position %+v, want the limit %d filled at 1.0989", position, limit.Id)
+	}
+
+	// The take profit closes the buy on the bid, 22 pips above the fill
+	tick(2, 1.1011)
+	history, _ := sim.GetTradesHistory(ctx, 0, 0)
+	if len(history) != 1 || history[0].Order != position.Order || history[0].Profit != 220 {
+		t.Errorf("history %+v, want the position closed with 220 profit", history)
+	}
+
+	if _, err := PlaceOrder(ctx, sim, DeletePending("EURUSD", CMD_SELL_STOP, stop.Id)); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if open, _ := sim.GetTrades(ctx, true); len(open) != 0 {
+		t.Errorf("open trades %+v after deleting the stop, want none", open)
+	}
+}
+
+func TestSimulatorChargesSwaps(t *testing.T) {
+
+	ctx := context.Background()
+	sim, _, _ := newEURUSDSimulator(SymbolInfo{
+		SwapEnable:        true,
+		SwapType:          SWAP_TYPE_POINTS,
+		SwapLong:          -5,
+		SwapShort:         2,
+		SwapRollover3Days: float64(time.Wednesday),
+	})
+
+	if _, err := PlaceOrder(ctx, sim, MarketBuy("EURUSD", 1)); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	// Checked at noon from Tuesday on, the Wednesday night is charged three
+	// times and the nights after Saturday and Sunday are free
+	storage := []float64{-5, -10, -25, -30, -35, -35, -35, -40}
+
+	for day, want := range storage {
+		sim.HandleTick(TickPrice{Symbol: "EURUSD", Bid: 1.1, Ask: 1.1002, Timestamp: time.Date(2024, 1, 9+day, 12, 0, 0, 0, time.UTC).UnixMilli()})
+
+		open, _ := sim.GetTrades(ctx, true)
+		if len(open) != 1 || open[0].Storage != want {
+			t.Fatalf("%s: open trades %+v, want storage %v", time.Date(2024, 1, 9+day, 0, 0, 0, 0, time.UTC).Weekday(), open, want)
+		}
+	}
+}
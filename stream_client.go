@@ -73,6 +73,10 @@ func (c *StreamClient) Disconnect() error {
 	return c.disconnect()
 }
 
+func (c *StreamClient) IsDemo() bool {
+	return c.opts.IsDemo()
+}
+
 func (c *StreamClient) SetSessionId(sessionId string) {
 	c.sessionId = sessionId
 }
@@ -1,5 +1,10 @@
 package gxtb
 
+const (
+	TRADE_STATE_MODIFIED = "Modified"
+	TRADE_STATE_DELETED  = "Deleted"
+)
+
 type Balance struct {
 	Balance     float64 `json:"balance"`
 	Credit      float64 `json:"credit"`
@@ -24,6 +24,10 @@ func (o StreamOptions) GetUrl() url.URL {
 	return url.URL{Scheme: "wss", Host: "ws.xtb.com", Path: string(o.EndpointPath)}
 }
 
+func (o StreamOptions) IsDemo() bool {
+	return o.EndpointPath == DemoStream
+}
+
 func DefaultStreamOptions() StreamOptions {
 	return StreamOptions{
 		EndpointPath:        RealStream,
@@ -0,0 +1,109 @@
+package gxtb
+
+import (
+	"fmt"
+	"math"
+)
+
+type MarginMode int
+type ProfitMode int
+type SwapType int
+type SymbolType int
+
+const (
+	MARGIN_MODE_FOREX         MarginMode = 101
+	MARGIN_MODE_CFD_LEVERAGED MarginMode = 102
+	MARGIN_MODE_CFD           MarginMode = 103
+)
+
+const (
+	PROFIT_MODE_FOREX ProfitMode = 5
+	PROFIT_MODE_CFD   ProfitMode = 6
+)
+
+const (
+	SWAP_TYPE_POINTS SwapType = iota
+	SWAP_TYPE_BASE_CURRENCY
+	SWAP_TYPE_INTEREST
+	SWAP_TYPE_MARGIN_CURRENCY
+)
+
+func (m MarginMode) String() string {
+	switch m {
+	case MARGIN_MODE_FOREX:
+		return "FOREX"
+	case MARGIN_MODE_CFD_LEVERAGED:
+		return "CFD_LEVERAGED"
+	case MARGIN_MODE_CFD:
+		return "CFD"
+	default:
+		return fmt.Sprintf("MarginMode(%d)", int(m))
+	}
+}
+
+func (m ProfitMode) String() string {
+	switch m {
+	case PROFIT_MODE_FOREX:
+		return "FOREX"
+	case PROFIT_MODE_CFD:
+		return "CFD"
+	default:
+		return fmt.Sprintf("ProfitMode(%d)", int(m))
+	}
+}
+
+func (t SwapType) String() string {
+	switch t {
+	case SWAP_TYPE_POINTS:
+		return "POINTS"
+	case SWAP_TYPE_BASE_CURRENCY:
+		return "BASE_CURRENCY"
+	case SWAP_TYPE_INTEREST:
+		return "INTEREST"
+	case SWAP_TYPE_MARGIN_CURRENCY:
+		return "MARGIN_CURRENCY"
+	default:
+		return fmt.Sprintf("SwapType(%d)", int(t))
+	}
+}
+
+// SymbolType is the broker internal instrument type, its values are not documented.
+func (t SymbolType) String() string {
+	return fmt.Sprintf("SymbolType(%d)", int(t))
+}
+
+// Point returns the smallest price increment given by the symbol precision.
+func (s SymbolInfo) Point() float64 {
+	return math.Pow10(-s.Precision)
+}
+
+// PointValue returns the profit of one lot for a price move of one point,
+// in the profit currency of the symbol.
+func (s SymbolInfo) PointValue() float64 {
+
+	if s.TickSize > 0 && s.TickValue > 0 {
+		return s.Point() * s.TickValue / s.TickSize
+	}
+
+	return s.Point() * float64(s.ContractSize)
+}
+
+// RoundPrice rounds the price to the tick size and precision of the symbol.
+func (s SymbolInfo) RoundPrice(price float64) float64 {
+
+	if price == 0 {
+		return 0
+	}
+
+	if s.TickSize > 0 {
+		price = math.Round(price/s.TickSize) * s.TickSize
+	}
+
+	scale := math.Pow10(s.Precision)
+	return math.Round(price*scale) / scale
+}
+
+// RoundVolume rounds the volume down to the lot step of the symbol.
+func (s SymbolInfo) RoundVolume(volume float64) float64 {
+	return floorToStep(volume, s.LotStep)
+}
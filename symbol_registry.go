@@ -0,0 +1,219 @@
+package gxtb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type SymbolRegistryOptions struct {
+	CachePath       string        // File the symbols are cached in, no caching when empty
+	CacheTTL        time.Duration // Age after which the cache is not used on load
+	RefreshInterval time.Duration // Interval of background refreshes done by Run, the default when not positive
+}
+
+func DefaultSymbolRegistryOptions() SymbolRegistryOptions {
+	return SymbolRegistryOptions{
+		CacheTTL:        time.Hour * 24,
+		RefreshInterval: time.Hour,
+	}
+}
+
+type symbolCache struct {
+	Time    time.Time    `json:"time"`
+	Symbols []SymbolInfo `json:"symbols"`
+}
+
+// SymbolRegistry keeps the info of all symbols in memory, loaded once from
+// getAllSymbols or from a disk cache.
+type SymbolRegistry struct {
+	api     SymbolSource
+	opts    SymbolRegistryOptions
+	errorCb func(error)
+
+	mu      sync.RWMutex
+	symbols map[string]SymbolInfo
+	updated time.Time
+}
+
+func NewSymbolRegistry(api SymbolSource, opts SymbolRegistryOptions) *SymbolRegistry {
+
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefaultSymbolRegistryOptions().RefreshInterval
+	}
+
+	return &SymbolRegistry{
+		api:     api,
+		opts:    opts,
+		symbols: make(map[string]SymbolInfo),
+	}
+}
+
+// SetErrorCallback receives the errors of background refreshes, the registry
+// keeps serving the symbols loaded last.
+func (r *SymbolRegistry) SetErrorCallback(cb func(error)) {
+	r.errorCb = cb
+}
+
+// Load fills the registry from the cache when it is fresh, otherwise from the api.
+func (r *SymbolRegistry) Load(ctx context.Context) error {
+
+	if cache, err := r.readCache(); err == nil && time.Since(cache.Time) < r.opts.CacheTTL {
+		r.set(cache.Symbols, cache.Time)
+		return nil
+	}
+
+	return r.Refresh(ctx)
+}
+
+// Refresh reloads all symbols from the api and updates the cache.
+func (r *SymbolRegistry) Refresh(ctx context.Context) error {
+
+	symbols, err := r.api.GetAllSymbols(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to refresh symbols: %w", err)
+	}
+
+	now := time.Now()
+	r.set(symbols, now)
+
+	if r.opts.CachePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(symbolCache{now, symbols})
+	if err != nil {
+		return fmt.Errorf("unable to marshal symbol cache: %w", err)
+	}
+
+	return writeFileAtomic(r.opts.CachePath, data)
+}
+
+// Run refreshes the registry in the configured interval until the context is
+// canceled.
+func (r *SymbolRegistry) Run(ctx context.Context) error {
+
+	ticker := time.NewTicker(r.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil && r.errorCb != nil {
+				r.errorCb(err)
+			}
+		}
+	}
+}
+
+// Updated returns the time the symbols were fetched from the api.
+func (r *SymbolRegistry) Updated() time.Time {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.updated
+}
+
+func (r *SymbolRegistry) Symbol(name string) (SymbolInfo, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, exists := r.symbols[name]
+	return info, exists
+}
+
+// All returns all symbols sorted by name.
+func (r *SymbolRegistry) All() []SymbolInfo {
+
+	return r.filter(func(SymbolInfo) bool {
+		return true
+	})
+}
+
+func (r *SymbolRegistry) ByCategory(category string) []SymbolInfo {
+
+	return r.filter(func(info SymbolInfo) bool {
+		return info.CategoryName == category
+	})
+}
+
+func (r *SymbolRegistry) ByGroup(group string) []SymbolInfo {
+
+	return r.filter(func(info SymbolInfo) bool {
+		return info.GroupName == group
+	})
+}
+
+// ByCurrency returns the symbols with the currency as base or profit currency.
+func (r *SymbolRegistry) ByCurrency(currency string) []SymbolInfo {
+
+	return r.filter(func(info SymbolInfo) bool {
+		return info.Currency == currency || info.CurrencyProfit == currency
+	})
+}
+
+func (r *SymbolRegistry) filter(match func(SymbolInfo) bool) []SymbolInfo {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var symbols []SymbolInfo
+	for _, info := range r.symbols {
+		if match(info) {
+			symbols = append(symbols, info)
+		}
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Symbol < symbols[j].Symbol
+	})
+
+	return symbols
+}
+
+func (r *SymbolRegistry) set(symbols []SymbolInfo, updated time.Time) {
+
+	byName := make(map[string]SymbolInfo, len(symbols))
+	for _, info := range symbols {
+		byName[info.Symbol] = info
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.symbols = byName
+	r.updated = updated
+}
+
+func (r *SymbolRegistry) readCache() (symbolCache, error) {
+
+	var cache symbolCache
+
+	if r.opts.CachePath == "" {
+		return cache, os.ErrNotExist
+	}
+
+	data, err := os.ReadFile(r.opts.CachePath)
+	if err != nil {
+		return cache, err
+	}
+
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return cache, fmt.Errorf("unable to unmarshal symbol cache: %w", err)
+	}
+
+	if len(cache.Symbols) == 0 {
+		return cache, errors.New("symbol cache is empty")
+	}
+
+	return cache, nil
+}
@@ -0,0 +1,245 @@
+package gxtb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrMarketClosed = errors.New("market is closed")
+
+// TradingSession is a continuous period in which a symbol can be traded.
+type TradingSession struct {
+	Open  time.Time
+	Close time.Time
+}
+
+type TradingHoursOptions struct {
+	Location *time.Location // Broker time the hours are given in
+	CacheTTL time.Duration  // Age after which the hours of a symbol are fetched again
+}
+
+func DefaultTradingHoursOptions() TradingHoursOptions {
+
+	return TradingHoursOptions{
+		Location: brokerLocation(),
+		CacheTTL: time.Hour * 12,
+	}
+}
+
+type cachedTradingHours struct {
+	hours   TradingHours
+	fetched time.Time
+}
+
+// TradingCalendar answers whether symbols are tradeable based on getTradingHours.
+type TradingCalendar struct {
+	api   MarketData
+	opts  TradingHoursOptions
+	clock Clock
+
+	mu    sync.Mutex
+	hours map[string]cachedTradingHours
+}
+
+func NewTradingCalendar(api MarketData, opts TradingHoursOptions) *TradingCalendar {
+
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
+	return &TradingCalendar{
+		api:   api,
+		opts:  opts,
+		clock: SystemClock,
+		hours: make(map[string]cachedTradingHours),
+	}
+}
+
+// SetClock is the time CheckOrder checks the sessions at and cached hours
+// expire by.
+func (c *TradingCalendar) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+// Preload fetches the hours of many symbols in one request.
+func (c *TradingCalendar) Preload(ctx context.Context, symbols []string) error {
+
+	hours, err := c.api.GetTradingHours(ctx, symbols)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	for _, h := range hours {
+		c.hours[h.Symbol] = cachedTradingHours{h, now}
+	}
+
+	return nil
+}
+
+// Sessions returns the trading sessions of the symbol overlapping [from, to)
+// in broker time. Sessions continuing over midnight are merged.
+func (c *TradingCalendar) Sessions(ctx context.Context, symbol string, from, to time.Time) ([]TradingSession, error) {
+
+	hours, err := c.tradingHours(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := c.opts.Location
+	start := from.In(loc).AddDate(0, 0, -1)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+
+	var sessions []TradingSession
+	for ; day.Before(to.In(loc).AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		// The broker numbers days from Monday 1 to Sunday 7
+		weekday := int(day.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+
+		for _, rec := range hours.Trading {
+			if rec.Day != weekday {
+				continue
+			}
+			sessions = append(sessions, TradingSession{
+				Open:  wallClock(day, rec.FromT),
+				Close: wallClock(day, rec.ToT),
+			})
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Open.Before(sessions[j].Open)
+	})
+
+	var merged []TradingSession
+	for _, s := range sessions {
+		if n := len(merged); n > 0 && !s.Open.After(merged[n-1].Close) {
+			if s.Close.After(merged[n-1].Close) {
+				merged[n-1].Close = s.Close
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	var overlapping []TradingSession
+	for _, s := range merged {
+		if s.Close.After(from) && s.Open.Before(to) {
+			overlapping = append(overlapping, s)
+		}
+	}
+
+	return overlapping, nil
+}
+
+func (c *TradingCalendar) IsOpen(ctx context.Context, symbol string, t time.Time) (bool, error) {
+
+	session, err := c.session(ctx, symbol, t)
+	if err != nil {
+		return false, err
+	}
+
+	return !session.Open.After(t), nil
+}
+
+// NextOpen returns t when the market is open, otherwise the time it opens.
+func (c *TradingCalendar) NextOpen(ctx context.Context, symbol string, t time.Time) (time.Time, error) {
+
+	session, err := c.session(ctx, symbol, t)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if session.Open.After(t) {
+		return session.Open, nil
+	}
+
+	return t, nil
+}
+
+// NextClose returns the time the current or next session closes.
+func (c *TradingCalendar) NextClose(ctx context.Context, symbol string, t time.Time) (time.Time, error) {
+
+	session, err := c.session(ctx, symbol, t)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return session.Close, nil
+}
+
+// CheckOrder returns ErrMarketClosed for opening orders of closed markets.
+func (c *TradingCalendar) CheckOrder(ctx context.Context, info TransactionInfo) error {
+
+	if info.Type != TYPE_OPEN {
+		return nil
+	}
+
+	open, err := c.IsOpen(ctx, info.Symbol, c.clock.Now())
+	if err != nil {
+		return fmt.Errorf("unable to check trading hours: %w", err)
+	}
+
+	if !open {
+		return fmt.Errorf("%w: %s", ErrMarketClosed, info.Symbol)
+	}
+
+	return nil
+}
+
+// session returns the session containing t, or the next one.
+func (c *TradingCalendar) session(ctx context.Context, symbol string, t time.Time) (TradingSession, error) {
+
+	sessions, err := c.Sessions(ctx, symbol, t, t.AddDate(0, 0, 14))
+	if err != nil {
+		return TradingSession{}, err
+	}
+
+	if len(sessions) == 0 {
+		return TradingSession{}, fmt.Errorf("%w: %s has no session in the next two weeks", ErrMarketClosed, symbol)
+	}
+
+	return sessions[0], nil
+}
+
+func (c *TradingCalendar) tradingHours(ctx context.Context, symbol string) (TradingHours, error) {
+
+	c.mu.Lock()
+	cached, exists := c.hours[symbol]
+	c.mu.Unlock()
+
+	if exists && c.clock.Now().Sub(cached.fetched) < c.opts.CacheTTL {
+		return cached.hours, nil
+	}
+
+	hours, err := c.api.GetTradingHours(ctx, []string{symbol})
+	if err != nil {
+		return TradingHours{}, err
+	}
+
+	for _, h := range hours {
+		if h.Symbol == symbol {
+			c.mu.Lock()
+			c.hours[symbol] = cachedTradingHours{h, c.clock.Now()}
+			c.mu.Unlock()
+			return h, nil
+		}
+	}
+
+	return TradingHours{}, fmt.Errorf("no trading hours for %s", symbol)
+}
+
+// wallClock returns the time ms after midnight of day on the clock of its
+// location, days of daylight saving changes are an hour shorter or longer.
+func wallClock(day time.Time, ms int64) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, int(ms)*int(time.Millisecond), day.Location())
+}
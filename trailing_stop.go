@@ -0,0 +1,487 @@
+package gxtb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TrailingPosition is the view of a tracked position passed to trailing rules.
+type TrailingPosition struct {
+	Order     int
+	Symbol    string
+	Buy       bool
+	OpenPrice float64
+	StopLoss  float64
+	Point     float64 // Price of one point, given by symbol precision
+}
+
+// TrailingRule proposes a stop loss for the position at the current close
+// price (bid for buys, ask for sells). Returning false means no proposal.
+type TrailingRule interface {
+	StopLoss(pos TrailingPosition, price float64, ts time.Time) (float64, bool)
+}
+
+// FixedTrail keeps the stop loss a fixed number of points behind the price.
+type FixedTrail struct {
+	Distance float64 // Points
+}
+
+func (r FixedTrail) StopLoss(pos TrailingPosition, price float64, ts time.Time) (float64, bool) {
+	return trailFrom(pos, price, r.Distance*pos.Point), true
+}
+
+// StepTrail starts trailing once the profit reaches Trigger points and then
+// moves the stop loss in increments of Step points, Distance points behind the
+// last reached step.
+type StepTrail struct {
+	Trigger  float64
+	Step     float64
+	Distance float64
+}
+
+func (r StepTrail) StopLoss(pos TrailingPosition, price float64, ts time.Time) (float64, bool) {
+
+	profit := profitPoints(pos, price)
+	if profit < r.Trigger || r.Step <= 0 {
+		return 0, false
+	}
+
+	steps := math.Floor((profit - r.Trigger) / r.Step)
+	reached := r.Trigger + steps*r.Step
+
+	return trailFrom(pos, openOffset(pos, reached), r.Distance*pos.Point), true
+}
+
+// BreakEven moves the stop loss to the open price plus Lock points once the
+// profit reaches After points.
+type BreakEven struct {
+	After float64
+	Lock  float64
+}
+
+func (r BreakEven) StopLoss(pos TrailingPosition, price float64, ts time.Time) (float64, bool) {
+
+	if profitPoints(pos, price) < r.After {
+		return 0, false
+	}
+
+	return openOffset(pos, r.Lock), true
+}
+
+// AtrTrail keeps the stop loss Multiplier times an average true range behind
+// the price. The range is measured on bars of Interval built from the ticks
+// and averaged exponentially over Period bars. The zero value proposes nothing.
+type AtrTrail struct {
+	Interval   time.Duration
+	Period     int
+	Multiplier float64
+
+	mu    sync.Mutex
+	state map[string]*atrState
+}
+
+type atrState struct {
+	start     time.Time
+	high, low float64
+	prevClose float64
+	close     float64
+	atr       float64
+	bars      int
+}
+
+func NewAtrTrail(interval time.Duration, period int, multiplier float64) *AtrTrail {
+
+	return &AtrTrail{
+		Interval:   interval,
+		Period:     period,
+		Multiplier: multiplier,
+	}
+}
+
+func (r *AtrTrail) StopLoss(pos TrailingPosition, price float64, ts time.Time) (float64, bool) {
+
+	if r.Interval <= 0 || r.Period <= 0 {
+		return 0, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == nil {
+		r.state = make(map[string]*atrState)
+	}
+
+	s, exists := r.state[pos.Symbol]
+	if !exists {
+		s = &atrState{start: ts.Truncate(r.Interval), high: price, low: price, close: price}
+		r.state[pos.Symbol] = s
+	}
+
+	if ts.Sub(s.start) >= r.Interval {
+		tr := s.high - s.low
+		if s.bars > 0 {
+			tr = math.Max(s.high, s.prevClose) - math.Min(s.low, s.prevClose)
+		}
+		if s.bars == 0 {
+			s.atr = tr
+		} else {
+			s.atr += (tr - s.atr) / float64(r.Period)
+		}
+		s.bars++
+		s.prevClose = s.close
+		s.start = ts.Truncate(r.Interval)
+		s.high, s.low = price, price
+	}
+
+	s.high = math.Max(s.high, price)
+	s.low = math.Min(s.low, price)
+	s.close = price
+
+	if s.bars < r.Period {
+		return 0, false
+	}
+
+	return trailFrom(pos, price, r.Multiplier*s.atr), true
+}
+
+type TrailingOptions struct {
+	MinModifyInterval time.Duration // Minimum time between two modifications of one position
+	ModifyTimeout     time.Duration // Time the modifications of one tick may take, the default when not positive
+}
+
+func DefaultTrailingOptions() TrailingOptions {
+	return TrailingOptions{
+		MinModifyInterval: time.Second,
+		ModifyTimeout:     time.Second * 10,
+	}
+}
+
+// trailModification is a stop loss modification sent by HandleTick.
+type trailModification struct {
+	p     *trailedPosition
+	order int
+	sl    float64
+	info  TransactionInfo
+	err   error
+}
+
+type trailedPosition struct {
+	pos        TrailingPosition
+	cmd        TradeCmd
+	volume     float64
+	tp         float64
+	rules      []TrailingRule
+	lastModify time.Time
+	inFlight   bool
+}
+
+// TrailingEngine trails stop losses of open positions on the client side by
+// sending TYPE_MODIFY transactions. The caller subscribes the streams and
+// feeds HandleTick with the tick prices of the tracked symbols and
+// HandleTrade with the trades.
+type TrailingEngine struct {
+	api     Broker
+	opts    TrailingOptions
+	errorCb func(error)
+
+	mu        sync.Mutex
+	positions map[int]*trailedPosition
+	symbols   map[string]SymbolInfo
+}
+
+func NewTrailingEngine(api Broker, opts TrailingOptions) *TrailingEngine {
+
+	if opts.ModifyTimeout <= 0 {
+		opts.ModifyTimeout = DefaultTrailingOptions().ModifyTimeout
+	}
+
+	return &TrailingEngine{
+		api:       api,
+		opts:      opts,
+		positions: make(map[int]*trailedPosition),
+		symbols:   make(map[string]SymbolInfo),
+	}
+}
+
+// SetErrorCallback reports rejected stop loss modifications, the position
+// keeps being trailed with its last accepted stop loss.
+func (e *TrailingEngine) SetErrorCallback(cb func(error)) {
+	e.errorCb = cb
+}
+
+// Track starts trailing the open position with the given rules. When several
+// rules propose a stop loss, the one closest to the price wins.
+func (e *TrailingEngine) Track(ctx context.Context, rec TradeRecord, rules ...TrailingRule) error {
+
+	cmd := TradeCmd(rec.Cmd)
+	if !isMarketCmd(cmd) {
+		return fmt.Errorf("unable to track order %d: not an open position", rec.Order)
+	}
+
+	e.mu.Lock()
+	symbol, known := e.symbols[rec.Symbol]
+	e.mu.Unlock()
+
+	if !known {
+		var err error
+		if symbol, err = e.api.GetSymbol(ctx, rec.Symbol); err != nil {
+			return fmt.Errorf("unable to track order %d: %w", rec.Order, err)
+		}
+	}
+
+	e.mu.Lock()
+	e.symbols[rec.Symbol] = symbol
+	e.positions[positionKey(rec.Position, rec.Order)] = &trailedPosition{
+		pos: TrailingPosition{
+			Order:     rec.Order,
+			Symbol:    rec.Symbol,
+			Buy:       isBuyCmd(cmd),
+			OpenPrice: rec.OpenPrice,
+			StopLoss:  rec.SL,
+			Point:     symbol.Point(),
+		},
+		cmd:    cmd,
+		volume: rec.Volume,
+		tp:     rec.TP,
+		rules:  rules,
+	}
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Untrack stops trailing the position.
+func (e *TrailingEngine) Untrack(position int) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.untrack(position)
+}
+
+// untrack must be called with the lock held.
+func (e *TrailingEngine) untrack(position int) {
+
+	p, exists := e.positions[position]
+	if !exists {
+		return
+	}
+	delete(e.positions, position)
+
+	for _, other := range e.positions {
+		if other.pos.Symbol == p.pos.Symbol {
+			return
+		}
+	}
+	delete(e.symbols, p.pos.Symbol)
+}
+
+// HandleTrade is a GetTradesCb which stops trailing closed positions and
+// picks up stop loss changes made elsewhere. A partial close keeps trailing
+// the remaining volume.
+func (e *TrailingEngine) HandleTrade(trade Trade) {
+
+	key := positionKey(trade.Position, trade.Order)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, exists := e.positions[key]
+	if !exists {
+		return
+	}
+
+	if !trade.Closed {
+		// The remaining part of a partially closed position may get a new order number
+		p.pos.Order = trade.Order
+		p.pos.StopLoss = trade.StopLoss
+		p.tp = trade.TakeProfit
+		p.volume = trade.Volume
+		return
+	}
+
+	if trade.Volume < p.volume-volumeEpsilon {
+		p.volume = roundDigits(p.volume-trade.Volume, 8)
+		return
+	}
+
+	e.untrack(key)
+}
+
+// HandleTick is the GetTickPricesCb driving the engine. The tick timestamp is
+// the clock of the engine. Modifications are sent in the background in order
+// of the position numbers, so the stream is not held up by the server, and a
+// position is skipped by further ticks until its modification is answered.
+func (e *TrailingEngine) HandleTick(tick TickPrice) {
+
+	// Only the top of the book is relevant
+	if tick.Level != 0 {
+		return
+	}
+
+	ts := time.UnixMilli(tick.Timestamp)
+
+	var mods []trailModification
+
+	e.mu.Lock()
+
+	symbol, exists := e.symbols[tick.Symbol]
+	if !exists {
+		e.mu.Unlock()
+		return
+	}
+
+	for _, p := range e.positions {
+		if p.pos.Symbol != tick.Symbol || p.inFlight {
+			continue
+		}
+
+		price := tick.Ask
+		if p.pos.Buy {
+			price = tick.Bid
+		}
+
+		sl, ok := e.proposeStopLoss(p, price, ts, symbol)
+		if !ok || ts.Sub(p.lastModify) < e.opts.MinModifyInterval {
+			continue
+		}
+
+		// The request is built here, the position may change while it is sent
+		info, err := ModifyPosition(p.pos.Symbol, p.cmd, p.pos.Order).
+			Price(price).
+			StopLoss(sl).
+			TakeProfit(p.tp).
+			Build(symbol)
+
+		p.inFlight = true
+		p.lastModify = ts
+		mods = append(mods, trailModification{p, p.pos.Order, sl, info, err})
+	}
+
+	e.mu.Unlock()
+
+	if len(mods) == 0 {
+		return
+	}
+
+	sort.Slice(mods, func(i, j int) bool {
+		return mods[i].order < mods[j].order
+	})
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), e.opts.ModifyTimeout)
+		defer cancel()
+
+		for _, m := range mods {
+			e.modify(ctx, m)
+		}
+	}()
+}
+
+func (e *TrailingEngine) proposeStopLoss(p *trailedPosition, price float64, ts time.Time, symbol SymbolInfo) (float64, bool) {
+
+	best, found := 0.0, false
+
+	for _, rule := range p.rules {
+		sl, ok := rule.StopLoss(p.pos, price, ts)
+		if !ok {
+			continue
+		}
+		if !found || (p.pos.Buy && sl > best) || (!p.pos.Buy && sl < best) {
+			best, found = sl, true
+		}
+	}
+
+	if !found {
+		return 0, false
+	}
+
+	// Honor the minimal distance of stops from the price
+	minDistance := symbol.StopsLevel * p.pos.Point
+	if p.pos.Buy {
+		best = math.Min(best, price-minDistance)
+	} else {
+		best = math.Max(best, price+minDistance)
+	}
+	best = symbol.RoundPrice(best)
+
+	// Never move the stop loss against the position
+	if p.pos.StopLoss != 0 {
+		if p.pos.Buy && best < p.pos.StopLoss+p.pos.Point/2 {
+			return 0, false
+		}
+		if !p.pos.Buy && best > p.pos.StopLoss-p.pos.Point/2 {
+			return 0, false
+		}
+	}
+
+	return best, true
+}
+
+func (e *TrailingEngine) modify(ctx context.Context, m trailModification) {
+
+	err := m.err
+	if err == nil {
+		_, err = e.api.TradeTransaction(ctx, m.info)
+	}
+
+	e.mu.Lock()
+	m.p.inFlight = false
+	if err == nil {
+		m.p.pos.StopLoss = m.sl
+	}
+	e.mu.Unlock()
+
+	if err != nil {
+		e.reportError(fmt.Errorf("unable to trail stop loss of order %d: %w", m.order, err))
+	}
+}
+
+func (e *TrailingEngine) reportError(err error) {
+
+	if e.errorCb != nil {
+		e.errorCb(err)
+	}
+}
+
+func profitPoints(pos TrailingPosition, price float64) float64 {
+
+	if pos.Buy {
+		return (price - pos.OpenPrice) / pos.Point
+	}
+
+	return (pos.OpenPrice - price) / pos.Point
+}
+
+func openOffset(pos TrailingPosition, points float64) float64 {
+
+	if pos.Buy {
+		return pos.OpenPrice + points*pos.Point
+	}
+
+	return pos.OpenPrice - points*pos.Point
+}
+
+func trailFrom(pos TrailingPosition, price, distance float64) float64 {
+
+	if pos.Buy {
+		return price - distance
+	}
+
+	return price + distance
+}
+
+// positionKey returns the position number, falling back to the order number
+// for records without one.
+func positionKey(position, order int) int {
+
+	if position != 0 {
+		return position
+	}
+
+	return order
+}
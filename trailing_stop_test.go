@@ -0,0 +1,110 @@
+package gxtb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrailingEngineFollowsPrice(t *testing.T) {
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+
+	sim := NewSimulator([]SymbolInfo{{
+		Symbol:         "EURUSD",
+		Currency:       "EUR",
+		CurrencyProfit: "USD",
+		ContractSize:   100000,
+		Leverage:       5,
+		LotMin:         0.01,
+		LotStep:        0.01,
+		MarginMode:     MARGIN_MODE_FOREX,
+		Precision:      5,
+	}}, SimulatorOptions{Currency: "USD", Balance: 10000})
+
+	engine := NewTrailingEngine(sim, DefaultTrailingOptions())
+	sim.Stream().GetTrades(ctx, engine.HandleTrade)
+
+	// Both the simulator and the engine are fed from the tick stream
+	tick := func(ts time.Time, bid float64) {
+		tick := TickPrice{Symbol: "EURUSD", Bid: bid, Ask: bid + 0.0002, Timestamp: ts.UnixMilli()}
+		sim.HandleTick(tick)
+		engine.HandleTick(tick)
+	}
+
+	tick(start, 1.1)
+	if _, err := PlaceOrder(ctx, sim, MarketBuy("EURUSD", 1)); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	trades, _ := sim.GetTrades(ctx, true)
+	if len(trades) != 1 {
+		t.Fatalf("got %d open trades, want 1", len(trades))
+	}
+	if err := engine.Track(ctx, trades[0], FixedTrail{Distance: 100}); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	stopLoss := func(want float64) {
+		t.Helper()
+
+		// Modifications are sent in the background
+		deadline := time.Now().Add(time.Second)
+		for {
+			trades, _ := sim.GetTrades(ctx, true)
+			if len(trades) == 1 && trades[0].SL == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("open trades %+v, want stop loss %v", trades, want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	tick(start.Add(2*time.Second), 1.1050)
+	stopLoss(1.1040)
+
+	// A falling price leaves the stop loss where it is
+	tick(start.Add(4*time.Second), 1.1045)
+	tick(start.Add(6*time.Second), 1.1070)
+	stopLoss(1.1060)
+
+	// The stop loss is hit and the closed position is no longer trailed
+	tick(start.Add(8*time.Second), 1.1055)
+	if trades, _ := sim.GetTrades(ctx, true); len(trades) != 0 {
+		t.Fatalf("open trades %+v after the stop loss, want none", trades)
+	}
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	if len(engine.positions) != 0 || len(engine.symbols) != 0 {
+		t.Errorf("closed position is still tracked")
+	}
+}
+
+func TestAtrTrailWarmsUp(t *testing.T) {
+
+	pos := TrailingPosition{Symbol: "EURUSD", Buy: true, OpenPrice: 1.1, Point: 0.00001}
+	start := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+	rule := NewAtrTrail(time.Minute, 3, 2)
+
+	// Every minute ranges 0.001 around a slowly rising price
+	for i := 0; i < 8; i++ {
+		price := 1.1 + float64(i/2)*0.0001 + float64(i%2)*0.001
+		sl, ok := rule.StopLoss(pos, price, start.Add(time.Duration(i)*30*time.Second))
+
+		if warm := i >= 6; ok != warm {
+			t.Fatalf("tick %d proposes %v, want %v", i, ok, warm)
+		}
+		// Twice the range of about 0.001 behind the price
+		if distance := price - sl; ok && (distance < 0.0015 || distance > 0.0025) {
+			t.Errorf("tick %d proposes %v, %v behind the price", i, sl, distance)
+		}
+	}
+
+	if _, ok := (&AtrTrail{}).StopLoss(pos, 1.1, start); ok {
+		t.Errorf("zero AtrTrail proposes a stop loss")
+	}
+}
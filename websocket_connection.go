@@ -4,23 +4,37 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
 type websocketConnection struct {
 	ws *websocket.Conn
+
+	readMu  sync.Mutex
+	reading chan goCommChan // Read outliving its context, its message is returned by the next read
+
+	writeMu sync.Mutex
+	writing chan error // Write outliving its context, awaited by the next write
 }
 
 func (c *websocketConnection) connect(ctx context.Context, url url.URL) error {
 
-	var err error
-
-	c.ws, _, err = websocket.DefaultDialer.DialContext(ctx, url.String(), nil)
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, url.String(), nil)
 	if err != nil {
 		return fmt.Errorf("unable to dial %v: %w", url, err)
 	}
 
+	c.readMu.Lock()
+	c.reading = nil
+	c.readMu.Unlock()
+
+	c.writeMu.Lock()
+	c.writing = nil
+	c.ws = ws
+	c.writeMu.Unlock()
+
 	return nil
 }
 
@@ -29,36 +43,59 @@ func (c *websocketConnection) disconnect() error {
 	return c.ws.Close()
 }
 
+// write sends the message. A write canceled by the context keeps running and
+// the next write waits for it, so there is never more than one writer.
 func (c *websocketConnection) write(ctx context.Context, data []byte) error {
 
-	commChan := make(chan goCommChan)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 
-	go func() {
-		err := c.ws.WriteMessage(websocket.TextMessage, data)
-		commChan <- goCommChan{nil, err}
-	}()
+	if c.writing != nil {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("write canceled: %w", ctx.Err())
+		case <-c.writing:
+			c.writing = nil
+		}
+	}
+
+	c.writing = make(chan error, 1)
+
+	go func(ws *websocket.Conn, done chan error) {
+		done <- ws.WriteMessage(websocket.TextMessage, data)
+	}(c.ws, c.writing)
 
 	select {
 	case <-ctx.Done():
 		return fmt.Errorf("write canceled: %w", ctx.Err())
-	case resp := <-commChan:
-		return resp.err
+	case err := <-c.writing:
+		c.writing = nil
+		return err
 	}
 }
 
+// read receives the next message. A read canceled by the context keeps
+// running and its message is returned by the next read, so there is never
+// more than one reader and no message is lost.
 func (c *websocketConnection) read(ctx context.Context) ([]byte, error) {
 
-	commChan := make(chan goCommChan)
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
 
-	go func() {
-		_, p, err := c.ws.ReadMessage()
-		commChan <- goCommChan{p, err}
-	}()
+	if c.reading == nil {
+		c.reading = make(chan goCommChan, 1)
+
+		go func(ws *websocket.Conn, done chan goCommChan) {
+			_, p, err := ws.ReadMessage()
+			done <- goCommChan{p, err}
+		}(c.ws, c.reading)
+	}
 
 	select {
 	case <-ctx.Done():
 		return nil, fmt.Errorf("read canceled: %w", ctx.Err())
-	case resp := <-commChan:
+	case resp := <-c.reading:
+		c.reading = nil
 		return resp.data.([]byte), resp.err
 	}
 }